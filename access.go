@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+type RepositoryAccess struct {
+	Collaborators []string          `json:"collaborators,omitempty"`
+	Teams         []TeamPermission  `json:"teams,omitempty"`
+	Errors        map[string]string `json:"errors,omitempty"`
+}
+
+type TeamPermission struct {
+	Team       string   `json:"team"`
+	Permission string   `json:"permission"`
+	Members    []string `json:"members,omitempty"`
+}
+
+type hubPage struct {
+	Next    string            `json:"next"`
+	Results []json.RawMessage `json:"results"`
+}
+
+func hubCredentials() (string, string) {
+	return settings.Hub.Username, settings.Hub.Token
+}
+
+// hubSession is the Docker Hub login shared by every Hub API request of a
+// run, so credentials are exchanged for a JWT once.
+var hubSession struct {
+	once sync.Once
+	jwt  string
+	err  error
+	warn sync.Once
+}
+
+// hubToken logs in with the configured Docker Hub username and personal
+// access token on first use. It returns "" without an error when no
+// credentials are configured.
+func hubToken() (string, error) {
+	hubSession.once.Do(func() {
+		username, password := hubCredentials()
+		if username == "" || password == "" {
+			return
+		}
+		hubSession.jwt, hubSession.err = hubLogin(username, password)
+		if hubSession.err == nil {
+			logger.Debug("logged in to Docker Hub", "username", username)
+		}
+	})
+	return hubSession.jwt, hubSession.err
+}
+
+// hubTokenOrAnonymous is hubToken for requests that work without a login:
+// a failed login is reported once and "" is returned.
+func hubTokenOrAnonymous() string {
+	jwt, err := hubToken()
+	if err != nil {
+		hubSession.warn.Do(func() {
+			logger.Warn("Docker Hub login failed, continuing anonymously", "error", err, "hint", errorHint(err))
+		})
+		return ""
+	}
+	return jwt
+}
+
+func hubLogin(username, password string) (string, error) {
+	body, err := json.Marshal(map[string]string{"username": username, "password": password})
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := httpClient.Post("https://hub.docker.com/v2/users/login/", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if err := classifyResponse(resp, "log in to Docker Hub"); err != nil {
+		return "", err
+	}
+
+	var login struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&login); err != nil {
+		return "", err
+	}
+	return login.Token, nil
+}
+
+func fetchHubPages(url, jwt, op string, each func(json.RawMessage) error) error {
+	for url != "" {
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+jwt)
+
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			return err
+		}
+
+		if err := classifyResponse(resp, op); err != nil {
+			resp.Body.Close()
+			return err
+		}
+
+		var page hubPage
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		for _, item := range page.Results {
+			if err := each(item); err != nil {
+				return err
+			}
+		}
+		url = page.Next
+	}
+	return nil
+}
+
+// getRepositoryAccess collects who can push to a repository. Docker Hub only
+// exposes this to accounts with admin rights on the repository, so each part
+// that could not be read is recorded in Errors instead of failing the scan.
+func getRepositoryAccess(repo, jwt string) *RepositoryAccess {
+	path := hubRepoPath(repo)
+	namespace := strings.SplitN(path, "/", 2)[0]
+	access := &RepositoryAccess{Errors: make(map[string]string)}
+
+	collaboratorsURL := fmt.Sprintf("https://hub.docker.com/v2/repositories/%s/collaborators/", path)
+	err := fetchHubPages(collaboratorsURL, jwt, "list collaborators", func(item json.RawMessage) error {
+		var collaborator struct {
+			User string `json:"user"`
+		}
+		if err := json.Unmarshal(item, &collaborator); err != nil {
+			return err
+		}
+		access.Collaborators = append(access.Collaborators, collaborator.User)
+		return nil
+	})
+	if err != nil {
+		access.Errors["collaborators"] = err.Error()
+	}
+
+	groupsURL := fmt.Sprintf("https://hub.docker.com/v2/repositories/%s/groups/", path)
+	err = fetchHubPages(groupsURL, jwt, "list team permissions", func(item json.RawMessage) error {
+		var group struct {
+			Name       string `json:"group_name"`
+			Permission string `json:"permission"`
+		}
+		if err := json.Unmarshal(item, &group); err != nil {
+			return err
+		}
+		access.Teams = append(access.Teams, TeamPermission{Team: group.Name, Permission: group.Permission})
+		return nil
+	})
+	if err != nil {
+		access.Errors["teams"] = err.Error()
+	}
+
+	for i, team := range access.Teams {
+		membersURL := fmt.Sprintf("https://hub.docker.com/v2/orgs/%s/groups/%s/members/", namespace, team.Team)
+		err := fetchHubPages(membersURL, jwt, "list team members", func(item json.RawMessage) error {
+			var member struct {
+				Username string `json:"username"`
+			}
+			if err := json.Unmarshal(item, &member); err != nil {
+				return err
+			}
+			access.Teams[i].Members = append(access.Teams[i].Members, member.Username)
+			return nil
+		})
+		if err != nil {
+			access.Errors["members:"+team.Team] = err.Error()
+		}
+	}
+
+	if len(access.Errors) == 0 {
+		access.Errors = nil
+	}
+	return access
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// AllowlistEntry marks a match as a false positive. Findings with the same
+// rule and value are dropped from later scans; Path, when set, limits the
+// entry to files whose path ends with it.
+type AllowlistEntry struct {
+	Rule   string `json:"rule"`
+	Match  string `json:"match"`
+	Path   string `json:"path,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// BaselineEntry records a finding someone confirmed as a real leak.
+type BaselineEntry struct {
+	Image     string    `json:"image"`
+	Path      string    `json:"path"`
+	Rule      string    `json:"rule"`
+	Match     string    `json:"match"`
+	Confirmed time.Time `json:"confirmed"`
+}
+
+func (e AllowlistEntry) allows(path, rule, match string) bool {
+	return e.Rule == rule && e.Match == match && strings.HasSuffix(path, e.Path)
+}
+
+// dispositionFile returns where name is read from and written to: the
+// configured path, an existing copy in the config search path, or the user
+// config directory.
+func dispositionFile(path, name string) string {
+	if resolved := resolveConfigFile(path, name); resolved != "" {
+		return resolved
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return name
+	}
+	return filepath.Join(dir, "dockerspy", name)
+}
+
+func loadJSONList(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func saveJSONList(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o600)
+}
+
+func loadAllowlist(path string) ([]AllowlistEntry, error) {
+	var entries []AllowlistEntry
+	err := loadJSONList(path, &entries)
+	return entries, err
+}
+
+// applyAllowlist removes allowlisted matches in place and returns how many
+// were dropped.
+func applyAllowlist(matches map[string]map[string][]string, entries []AllowlistEntry) int {
+	if len(entries) == 0 {
+		return 0
+	}
+	dropped := 0
+	for path, rules := range matches {
+		for rule, values := range rules {
+			kept := values[:0]
+			for _, value := range values {
+				allowed := false
+				for _, entry := range entries {
+					if entry.allows(path, rule, value) {
+						allowed = true
+						break
+					}
+				}
+				if allowed {
+					dropped++
+					continue
+				}
+				kept = append(kept, value)
+			}
+			if len(kept) == 0 {
+				delete(rules, rule)
+			} else {
+				rules[rule] = kept
+			}
+		}
+		if len(rules) == 0 {
+			delete(matches, path)
+		}
+	}
+	return dropped
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// SecretLifetime records in which tags a secret was present, ordered by
+// tag push date.
+type SecretLifetime struct {
+	Rule         string   `json:"rule"`
+	Match        string   `json:"match"`
+	Files        []string `json:"files"`
+	FirstSeen    string   `json:"firstSeen"`
+	LastSeen     string   `json:"lastSeen"`
+	DisappearsIn string   `json:"disappearsIn,omitempty"`
+	Tags         []string `json:"tags"`
+}
+
+type Timeline struct {
+	Repo    string            `json:"repo"`
+	Tags    []string          `json:"tags"`
+	Failed  map[string]string `json:"failed,omitempty"`
+	Secrets []*SecretLifetime `json:"secrets"`
+}
+
+type datedTag struct {
+	Name        string
+	LastUpdated string
+}
+
+func fetchAllTags(repo string) ([]datedTag, error) {
+	listing, err := fetchTagPages(repo, "", 0)
+	if err != nil {
+		return nil, err
+	}
+	return datedTags(listing.Results), nil
+}
+
+// fetchRecentTags returns the n most recently pushed tags, newest first.
+func fetchRecentTags(repo string, n int) ([]datedTag, error) {
+	listing, err := fetchTagPages(repo, "last_updated", n)
+	if err != nil {
+		return nil, err
+	}
+	tags := datedTags(listing.Results)
+	sort.SliceStable(tags, func(i, j int) bool {
+		return tags[i].LastUpdated > tags[j].LastUpdated
+	})
+	if len(tags) > n {
+		tags = tags[:n]
+	}
+	return tags, nil
+}
+
+func datedTags(summaries []TagSummary) []datedTag {
+	tags := make([]datedTag, len(summaries))
+	for i, tag := range summaries {
+		tags[i] = datedTag{Name: tag.Name, LastUpdated: tag.LastUpdated}
+	}
+	return tags
+}
+
+// fetchTagPages follows the tag pages in the given Hub ordering until limit
+// tags passed --tag-filter, or to the end when limit is 0. Results holds
+// those tags, Fetched how many were read to find them and Count the
+// repository's total.
+func fetchTagPages(repo, ordering string, limit int) (*TagsResult, error) {
+	url := fmt.Sprintf("https://hub.docker.com/v2/repositories/%s/tags?page_size=%d", hubRepoPath(repo), tagPageSize)
+	if ordering != "" {
+		url += "&ordering=" + ordering
+	}
+	listing := &TagsResult{}
+	for url != "" && (limit == 0 || len(listing.Results) < limit) {
+		data, err := hubGet(url, "list tags")
+		if err != nil {
+			return nil, err
+		}
+
+		var page TagsResult
+		if err := json.Unmarshal(data, &page); err != nil {
+			return nil, err
+		}
+		if page.Count > 0 && len(page.Results) == 0 && listing.Fetched == 0 {
+			return nil, newRegistryError(ErrHubSchema, "list tags", "")
+		}
+		listing.Count = page.Count
+		listing.Fetched += len(page.Results)
+		listing.Results = append(listing.Results, filterTags(page.Results)...)
+		url = page.Next
+	}
+	if limit > 0 && len(listing.Results) > limit {
+		listing.Results = listing.Results[:limit]
+	}
+	return listing, nil
+}
+
+// buildTimeline scans every tag from oldest to newest and tracks when each
+// distinct secret first appears and in which tag it is gone again. A secret
+// that comes back after a clean tag only reports its latest removal. When ctx
+// is cancelled the timeline covers the tags scanned so far.
+func buildTimeline(ctx context.Context, cfg *scanConfig, repo string) (*Timeline, []*Report, error) {
+	tags, err := fetchAllTags(repo)
+	if err != nil {
+		return nil, nil, err
+	}
+	// last_updated is RFC 3339 in UTC, so string order is time order.
+	sort.SliceStable(tags, func(i, j int) bool {
+		return tags[i].LastUpdated < tags[j].LastUpdated
+	})
+
+	timeline := &Timeline{Repo: repo, Failed: make(map[string]string)}
+	secrets := make(map[string]*SecretLifetime)
+	var reports []*Report
+	for _, tag := range tags {
+		if ctx.Err() != nil {
+			break
+		}
+		logger.Info("scanning tag", "repo", repo, "tag", tag.Name, "pushed", tag.LastUpdated)
+		report, err := scanImage(ctx, cfg, parseImageReference(repo+":"+tag.Name))
+		if ctx.Err() != nil {
+			// A partly scanned tag would make secrets look removed.
+			if err == nil {
+				reports = append(reports, report)
+			}
+			break
+		}
+		if err != nil {
+			logger.Error("error scanning tag", "tag", tag.Name, "error", err, "hint", errorHint(err))
+			timeline.Failed[tag.Name] = err.Error()
+			continue
+		}
+		reports = append(reports, report)
+
+		present := make(map[string]bool)
+		for source, rules := range report.Matches {
+			for rule, matches := range rules {
+				for _, match := range matches {
+					key := rule + "\x00" + match
+					secret, ok := secrets[key]
+					if !ok {
+						secret = &SecretLifetime{Rule: rule, Match: match, FirstSeen: tag.Name}
+						secrets[key] = secret
+						timeline.Secrets = append(timeline.Secrets, secret)
+					}
+					if !present[key] {
+						secret.Tags = append(secret.Tags, tag.Name)
+						secret.LastSeen = tag.Name
+						secret.DisappearsIn = ""
+						present[key] = true
+					}
+					if !containsString(secret.Files, source) {
+						secret.Files = append(secret.Files, source)
+					}
+				}
+			}
+		}
+		for key, secret := range secrets {
+			if !present[key] && secret.DisappearsIn == "" {
+				secret.DisappearsIn = tag.Name
+			}
+		}
+		timeline.Tags = append(timeline.Tags, tag.Name)
+	}
+
+	if len(timeline.Failed) == 0 {
+		timeline.Failed = nil
+	}
+	return timeline, reports, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func formatTimeline(timeline *Timeline, format string) ([]byte, error) {
+	if format == "json" {
+		return json.MarshalIndent(timeline, "", "  ")
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Leak timeline for %s (%d tags scanned, oldest first)\n", timeline.Repo, len(timeline.Tags))
+	if len(timeline.Secrets) == 0 {
+		b.WriteString("\nNo secrets found in any tag.\n")
+	}
+	for _, secret := range timeline.Secrets {
+		fmt.Fprintf(&b, "\n[%s] %s: %s\n", ruleSeverity(secret.Rule), secret.Rule, secret.Match)
+		fmt.Fprintf(&b, "  first seen:  %s\n", secret.FirstSeen)
+		fmt.Fprintf(&b, "  last seen:   %s\n", secret.LastSeen)
+		if secret.DisappearsIn != "" {
+			fmt.Fprintf(&b, "  removed in:  %s\n", secret.DisappearsIn)
+		} else {
+			b.WriteString("  removed in:  still present in the newest tag\n")
+		}
+		fmt.Fprintf(&b, "  present in:  %s\n", strings.Join(secret.Tags, ", "))
+		for _, file := range secret.Files {
+			fmt.Fprintf(&b, "  file:        %s\n", file)
+		}
+	}
+	for tag, reason := range timeline.Failed {
+		fmt.Fprintf(&b, "\nNot scanned: %s (%s)\n", tag, reason)
+	}
+	return []byte(b.String()), nil
+}
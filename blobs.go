@@ -0,0 +1,302 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultBlobCacheSize = 10 << 30
+
+type BlobStore interface {
+	Fetch(ctx context.Context, s *registrySession, desc Descriptor) (string, error)
+}
+
+type blobManager struct {
+	dir      string
+	maxBytes int64
+
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+func defaultBlobCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "dockerspy", "blobs")
+}
+
+func newBlobManager(dir string, maxBytes int64) (*blobManager, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &blobManager{dir: dir, maxBytes: maxBytes, locks: make(map[string]*sync.Mutex)}, nil
+}
+
+func (bm *blobManager) lockDigest(digest string) func() {
+	bm.mu.Lock()
+	lock, ok := bm.locks[digest]
+	if !ok {
+		lock = &sync.Mutex{}
+		bm.locks[digest] = lock
+	}
+	bm.mu.Unlock()
+
+	lock.Lock()
+	return lock.Unlock
+}
+
+func splitDigest(digest string) (string, string, error) {
+	parts := strings.Split(digest, ":")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("invalid digest format: %s", digest)
+	}
+	return parts[0], parts[1], nil
+}
+
+func (bm *blobManager) blobPath(digest string) (string, error) {
+	algo, hexDigest, err := splitDigest(digest)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(bm.dir, algo+"-"+hexDigest), nil
+}
+
+func (bm *blobManager) Fetch(ctx context.Context, s *registrySession, desc Descriptor) (string, error) {
+	path, err := bm.blobPath(desc.Digest)
+	if err != nil {
+		return "", err
+	}
+	defer bm.lockDigest(desc.Digest)()
+
+	if ok, err := verifyBlobFile(path, desc.Digest); err == nil && ok {
+		now := time.Now()
+		os.Chtimes(path, now, now)
+		logger.Info("using cached blob", "digest", desc.Digest)
+		progress.setStatus(layerBarFrom(ctx), "cached")
+		return path, nil
+	}
+
+	// A connection dropped mid-body resumes from the partial download.
+	// Failed requests are not retried here; the client's retryTransport
+	// already did.
+	partial := path + ".partial"
+	for attempt := 0; ; attempt++ {
+		err = bm.downloadFromSources(ctx, s, desc, partial)
+		if err == nil || ctx.Err() != nil || attempt >= registryRetry.attempts || !errors.Is(err, errDownloadInterrupted) || !transientError(err) {
+			break
+		}
+		logger.Warn("layer download interrupted, resuming", "digest", desc.Digest, "attempt", attempt+1, "error", err)
+		if err := registryRetry.sleep(ctx, attempt); err != nil {
+			return "", err
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	if err := os.Rename(partial, path); err != nil {
+		return "", err
+	}
+
+	bm.evictOverflow(path)
+	return path, nil
+}
+
+// downloadFromSources fetches a foreign layer from the URLs in its
+// descriptor, falling back to the registry, and any other blob from the
+// registry.
+func (bm *blobManager) downloadFromSources(ctx context.Context, s *registrySession, desc Descriptor, partial string) error {
+	var sources []string
+	if isForeignLayer(desc.MediaType) {
+		for _, source := range desc.URLs {
+			if strings.HasPrefix(source, "https://") || strings.HasPrefix(source, "http://") {
+				sources = append(sources, source)
+			}
+		}
+	}
+	sources = append(sources, s.blobURL(desc.Digest))
+
+	var err error
+	for _, source := range sources {
+		if err = bm.download(ctx, s, desc, source, partial); err == nil || ctx.Err() != nil {
+			return err
+		}
+		logger.Debug("could not download blob", "digest", desc.Digest, "url", source, "error", err)
+	}
+	return err
+}
+
+func (bm *blobManager) download(ctx context.Context, s *registrySession, desc Descriptor, source, partial string) error {
+	algo, expected, err := splitDigest(desc.Digest)
+	if err != nil {
+		return err
+	}
+	hasher, err := newDigestHasher(algo)
+	if err != nil {
+		return err
+	}
+
+	var offset int64
+	if existing, err := os.Open(partial); err == nil {
+		offset, err = io.Copy(hasher, existing)
+		existing.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	reqCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var req *http.Request
+	if source == s.blobURL(desc.Digest) {
+		req, err = s.newRequest(reqCtx, "GET", source)
+	} else {
+		// External URLs never see the registry credentials.
+		req, err = http.NewRequestWithContext(reqCtx, "GET", source, nil)
+	}
+	if err != nil {
+		return err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := s.do(downloadClient, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if offset > 0 && resp.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+		os.Remove(partial)
+		return bm.download(ctx, s, desc, source, partial)
+	}
+	if err := classifyResponse(resp, "download layer"); err != nil {
+		return err
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY
+	if resp.StatusCode == http.StatusPartialContent {
+		flags |= os.O_APPEND
+		logger.Info("resuming download", "digest", desc.Digest, "offset", offset)
+	} else {
+		flags |= os.O_TRUNC
+		offset = 0
+		hasher.Reset()
+	}
+
+	file, err := os.OpenFile(partial, flags, 0o600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	bar := layerBarFrom(ctx)
+	if bar != nil {
+		progress.setDone(bar, offset)
+		progress.setStatus(bar, "downloading")
+	}
+	progressWriter := &ProgressWriter{Writer: io.MultiWriter(file, hasher), Total: desc.Size, Downloaded: offset, Bar: bar}
+	body := guardStall(resp.Body, stallTimeout, cancel)
+	defer body.stop()
+	if _, err := io.Copy(progressWriter, body); err != nil {
+		return fmt.Errorf("%w: %w", errDownloadInterrupted, err)
+	}
+
+	if actual := hex.EncodeToString(hasher.Sum(nil)); actual != expected {
+		os.Remove(partial)
+		return newRegistryError(ErrDigestMismatch, "download layer", "got "+algo+":"+actual)
+	}
+	return nil
+}
+
+// newDigestHasher returns the hash behind a digest algorithm of the OCI
+// spec. Blobs with any other algorithm are refused rather than trusted.
+func newDigestHasher(algo string) (hash.Hash, error) {
+	switch algo {
+	case "sha256":
+		return sha256.New(), nil
+	case "sha512":
+		return sha512.New(), nil
+	}
+	return nil, fmt.Errorf("unsupported digest algorithm: %s", algo)
+}
+
+func verifyBlobFile(path, digest string) (bool, error) {
+	algo, expected, err := splitDigest(digest)
+	if err != nil {
+		return false, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	hasher, err := newDigestHasher(algo)
+	if err != nil {
+		return false, err
+	}
+	if _, err := io.Copy(hasher, file); err != nil {
+		return false, err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)) == expected, nil
+}
+
+func (bm *blobManager) evictOverflow(keep string) {
+	if bm.maxBytes <= 0 {
+		return
+	}
+
+	entries, err := os.ReadDir(bm.dir)
+	if err != nil {
+		return
+	}
+
+	type cached struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+	var blobs []cached
+	var total int64
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasSuffix(entry.Name(), ".partial") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		blobs = append(blobs, cached{filepath.Join(bm.dir, entry.Name()), info.Size(), info.ModTime()})
+		total += info.Size()
+	}
+
+	sort.Slice(blobs, func(i, j int) bool { return blobs[i].modTime.Before(blobs[j].modTime) })
+	for _, blob := range blobs {
+		if total <= bm.maxBytes {
+			break
+		}
+		if blob.path == keep {
+			continue
+		}
+		if err := os.Remove(blob.path); err == nil {
+			total -= blob.size
+		}
+	}
+}
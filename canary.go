@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"regexp"
+)
+
+// CanaryFinding flags a match that is almost certainly a tripwire rather than
+// a real credential: using it alerts whoever planted it.
+type CanaryFinding struct {
+	Path   string `json:"path"`
+	Rule   string `json:"rule"`
+	Match  string `json:"match"`
+	Reason string `json:"reason"`
+}
+
+const canaryURLRule = "canarytoken_url"
+
+var (
+	canaryURLPattern = regexp.MustCompile(`(?i)\b(?:[a-z0-9]{16,}\.)?canarytokens\.(?:com|org|net)(?:/[^\s"'<>]*)?|\b[a-z0-9-]+\.canary\.tools\b`)
+	awsKeyIDPattern  = regexp.MustCompile(`\b(?:AKIA|ASIA)[A-Z2-7]{16}\b`)
+)
+
+// AWS accounts that issue canarytokens.org and Thinkst Canary AWS keys, plus
+// accounts behind known look-alike honeytoken services.
+var canaryAWSAccounts = map[string]string{
+	"052310077262": "Thinkst canarytoken",
+	"171436882533": "Thinkst canarytoken",
+	"534261010715": "Thinkst canarytoken",
+	"595918472158": "Thinkst canarytoken",
+	"717712589309": "Thinkst canarytoken",
+	"819147034852": "Thinkst canarytoken",
+	"992382622183": "Thinkst canarytoken",
+	"730335385048": "Thinkst canarytoken",
+	"266735846894": "Thinkst canarytoken",
+	"044858866125": "honeytoken service",
+	"251728468259": "honeytoken service",
+	"344043088457": "honeytoken service",
+	"351906852752": "honeytoken service",
+	"390477818340": "honeytoken service",
+	"426127672474": "honeytoken service",
+	"427150556519": "honeytoken service",
+	"439872796651": "honeytoken service",
+	"445142720921": "honeytoken service",
+	"465867158099": "honeytoken service",
+	"637958123769": "honeytoken service",
+	"693412236332": "honeytoken service",
+	"732624840810": "honeytoken service",
+	"735421457923": "honeytoken service",
+	"959235150393": "honeytoken service",
+	"982842642351": "honeytoken service",
+}
+
+// awsAccountFromKeyID recovers the account ID encoded in an AKIA/ASIA access
+// key ID.
+func awsAccountFromKeyID(keyID string) (string, bool) {
+	if len(keyID) != 20 {
+		return "", false
+	}
+	decoded, err := base32.StdEncoding.DecodeString(keyID[4:])
+	if err != nil || len(decoded) < 6 {
+		return "", false
+	}
+	z := binary.BigEndian.Uint64(append([]byte{0, 0}, decoded[:6]...))
+	return fmt.Sprintf("%012d", (z&0x7fffffffff80)>>7), true
+}
+
+func canaryReason(rule, match string) string {
+	if rule == canaryURLRule {
+		return "canarytokens callback URL"
+	}
+	for _, keyID := range awsKeyIDPattern.FindAllString(match, -1) {
+		if account, ok := awsAccountFromKeyID(keyID); ok {
+			if service, known := canaryAWSAccounts[account]; known {
+				return fmt.Sprintf("AWS key of account %s (%s)", account, service)
+			}
+		}
+	}
+	return ""
+}
+
+func findCanaries(matches map[string]map[string][]string) []CanaryFinding {
+	var canaries []CanaryFinding
+	for path, rules := range matches {
+		for rule, found := range rules {
+			for _, match := range found {
+				if reason := canaryReason(rule, match); reason != "" {
+					canaries = append(canaries, CanaryFinding{Path: path, Rule: rule, Match: match, Reason: reason})
+				}
+			}
+		}
+	}
+	return canaries
+}
+
+// withoutCanaries returns a copy of matches with the canary findings
+// removed, for scoring.
+func withoutCanaries(matches map[string]map[string][]string) map[string]map[string][]string {
+	kept := make(map[string]map[string][]string)
+	for path, rules := range matches {
+		for rule, found := range rules {
+			for _, match := range found {
+				if canaryReason(rule, match) != "" {
+					continue
+				}
+				if kept[path] == nil {
+					kept[path] = make(map[string][]string)
+				}
+				kept[path][rule] = append(kept[path][rule], match)
+			}
+		}
+	}
+	return kept
+}
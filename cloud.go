@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cloudAuth, cleared by --no-cloud-auth, lets registries of AWS, Google
+// Cloud and Azure be authenticated with the ambient cloud credentials when
+// nothing else is configured for them.
+var cloudAuth = true
+
+var (
+	ecrRegistryPattern = regexp.MustCompile(`^(\d{12})\.dkr\.ecr(?:-fips)?\.([a-z0-9-]+)\.amazonaws\.com(?:\.cn)?$`)
+	gcrRegistryPattern = regexp.MustCompile(`^(?:[a-z0-9-]+\.)?gcr\.io$|^[a-z0-9-]+-docker\.pkg\.dev$`)
+	acrRegistryPattern = regexp.MustCompile(`^[a-z0-9]+\.azurecr\.(?:io|cn|us)$`)
+)
+
+// acrUsername is the fixed user name ACR expects with a refresh token.
+const acrUsername = "00000000-0000-0000-0000-000000000000"
+
+// metadataClient talks to the instance metadata services. They only answer
+// from inside the cloud, are never proxied and must fail fast elsewhere.
+var metadataClient = &http.Client{Timeout: 2 * time.Second, Transport: &http.Transport{Proxy: nil}}
+
+// cloudCredentials caches the exchanged credentials per registry, like
+// helperCredentials, so a batch scan exchanges tokens once.
+var (
+	cloudMu          sync.Mutex
+	cloudCredentials = make(map[string][2]string)
+)
+
+// cloudRegistryCredentials returns credentials for ECR, GCR, Artifact
+// Registry and ACR hosts obtained from the ambient cloud identity, or empty
+// strings for other registries and when none is available.
+func cloudRegistryCredentials(registry string) (string, string) {
+	if !cloudAuth {
+		return "", ""
+	}
+	var exchange func(string) (string, string, error)
+	var provider string
+	switch {
+	case ecrRegistryPattern.MatchString(registry):
+		exchange, provider = ecrCredentials, "ecr"
+	case gcrRegistryPattern.MatchString(registry):
+		exchange, provider = gcpCredentials, "gcp"
+	case acrRegistryPattern.MatchString(registry):
+		exchange, provider = acrCredentials, "acr"
+	default:
+		return "", ""
+	}
+
+	cloudMu.Lock()
+	defer cloudMu.Unlock()
+	creds, ok := cloudCredentials[registry]
+	if !ok {
+		username, password, err := exchange(registry)
+		if err != nil {
+			logger.Debug("no cloud credentials for registry", "provider", provider, "registry", registry, "error", err)
+		} else {
+			logger.Debug("using cloud credentials", "provider", provider, "registry", registry)
+		}
+		creds = [2]string{username, password}
+		cloudCredentials[registry] = creds
+	}
+	return creds[0], creds[1]
+}
+
+// ecrCredentials calls ECR GetAuthorizationToken with the keys in the
+// standard AWS environment variables, as the S3 sink does.
+func ecrCredentials(registry string) (string, string, error) {
+	if os.Getenv("AWS_ACCESS_KEY_ID") == "" || os.Getenv("AWS_SECRET_ACCESS_KEY") == "" {
+		return "", "", fmt.Errorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are not set")
+	}
+	match := ecrRegistryPattern.FindStringSubmatch(registry)
+	account, region := match[1], match[2]
+	endpoint := fmt.Sprintf("https://api.ecr.%s.amazonaws.com/", region)
+	if strings.HasSuffix(registry, ".cn") {
+		endpoint = fmt.Sprintf("https://api.ecr.%s.amazonaws.com.cn/", region)
+	}
+
+	body, err := json.Marshal(map[string][]string{"registryIds": {account}})
+	if err != nil {
+		return "", "", err
+	}
+	req, err := http.NewRequest("POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", "", err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "AmazonEC2ContainerRegistry_V20150921.GetAuthorizationToken")
+	signAWSRequest(req, body, region, "ecr")
+
+	var result struct {
+		AuthorizationData []struct {
+			AuthorizationToken string `json:"authorizationToken"`
+		} `json:"authorizationData"`
+	}
+	if err := doCloudRequest(httpClient, req, "get ECR authorization token", &result); err != nil {
+		return "", "", err
+	}
+	if len(result.AuthorizationData) == 0 {
+		return "", "", fmt.Errorf("ECR returned no authorization data")
+	}
+	decoded, err := base64.StdEncoding.DecodeString(result.AuthorizationData[0].AuthorizationToken)
+	if err != nil {
+		return "", "", err
+	}
+	username, password, _ := strings.Cut(string(decoded), ":")
+	return username, password, nil
+}
+
+// gcpCredentials uses a Google access token from GOOGLE_OAUTH_ACCESS_TOKEN,
+// the metadata server of a GCE, GKE or Cloud Run workload, or gcloud, in
+// that order.
+func gcpCredentials(registry string) (string, string, error) {
+	if token := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"); token != "" {
+		return "oauth2accesstoken", token, nil
+	}
+	req, err := http.NewRequest("GET", "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token", nil)
+	if err != nil {
+		return "", "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := doCloudRequest(metadataClient, req, "get GCP access token", &token); err == nil && token.AccessToken != "" {
+		return "oauth2accesstoken", token.AccessToken, nil
+	}
+	out, err := runCloudCLI("gcloud", "auth", "print-access-token")
+	if err != nil {
+		return "", "", err
+	}
+	return "oauth2accesstoken", out, nil
+}
+
+// acrCredentials exchanges an Azure AD access token, from the managed
+// identity of the machine or from the az CLI, for an ACR refresh token.
+func acrCredentials(registry string) (string, string, error) {
+	aadToken, err := azureAccessToken()
+	if err != nil {
+		return "", "", err
+	}
+	form := url.Values{"grant_type": {"access_token"}, "service": {registry}, "access_token": {aadToken}}
+	req, err := http.NewRequest("POST", "https://"+registry+"/oauth2/exchange", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	var result struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := doCloudRequest(httpClient, req, "exchange ACR refresh token", &result); err != nil {
+		return "", "", err
+	}
+	return acrUsername, result.RefreshToken, nil
+}
+
+func azureAccessToken() (string, error) {
+	const resource = "https://management.azure.com/"
+	req, err := http.NewRequest("GET", "http://169.254.169.254/metadata/identity/oauth2/token?api-version=2018-02-01&resource="+url.QueryEscape(resource), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata", "true")
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := doCloudRequest(metadataClient, req, "get Azure access token", &token); err == nil && token.AccessToken != "" {
+		return token.AccessToken, nil
+	}
+	return runCloudCLI("az", "account", "get-access-token", "--resource", resource, "--query", "accessToken", "--output", "tsv")
+}
+
+func doCloudRequest(client *http.Client, req *http.Request, op string, into interface{}) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := classifyResponse(resp, op); err != nil {
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(into)
+}
+
+// runCloudCLI runs a cloud CLI and returns its trimmed output, bounded like
+// a credential helper.
+func runCloudCLI(name string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), credentialHelperTimeout)
+	defer cancel()
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("%s: %v: %s", name, err, strings.TrimSpace(stderr.String()))
+	}
+	token := strings.TrimSpace(string(out))
+	if token == "" {
+		return "", fmt.Errorf("%s printed no token", name)
+	}
+	return token, nil
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+type complianceSummary struct {
+	Since, Until    time.Time
+	Scans           int
+	Images          int
+	NewLeaks        int
+	ResolvedLeaks   int
+	OpenLeaks       int
+	MeanTimeToFix   time.Duration
+	TopRepositories []repoLeakCount
+}
+
+type repoLeakCount struct {
+	Repo  string
+	Leaks int
+}
+
+type leakState struct {
+	firstSeen time.Time
+	openSince time.Time
+	open      bool
+}
+
+// loadReportHistory reads saved reports from files and directories of
+// .json files, such as the output of file or s3 sinks collected over time.
+// Reports written before scan times were recorded use the file's mtime.
+func loadReportHistory(paths []string) ([]*Report, error) {
+	var reports []*Report
+	load := func(path string) error {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		decoded, err := decodeReports(data)
+		if err != nil {
+			logger.Warn("skipping file that is not a report", "file", path, "error", err)
+			return nil
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		for _, report := range decoded {
+			if report.ScannedAt.IsZero() {
+				report.ScannedAt = info.ModTime().UTC()
+			}
+		}
+		reports = append(reports, decoded...)
+		return nil
+	}
+
+	for _, path := range paths {
+		err := filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() || (file != path && !strings.HasSuffix(file, ".json")) {
+				return nil
+			}
+			return load(file)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return reports, nil
+}
+
+// buildCompliance replays the report history per image in scan order. A leak
+// opens when a value first shows up in an image and is fixed by the first
+// later scan of the same image that no longer contains it.
+func buildCompliance(reports []*Report, since, until time.Time) *complianceSummary {
+	sort.SliceStable(reports, func(i, j int) bool {
+		return reports[i].ScannedAt.Before(reports[j].ScannedAt)
+	})
+	inWindow := func(t time.Time) bool {
+		return !t.Before(since) && !t.After(until)
+	}
+
+	summary := &complianceSummary{Since: since, Until: until}
+	leaks := make(map[string]*leakState)
+	images := make(map[string]bool)
+	repoLeaks := make(map[string]map[string]bool)
+	var fixTimes []time.Duration
+
+	for _, report := range reports {
+		if report.ScannedAt.After(until) {
+			break
+		}
+		image := reportImage(report)
+		if inWindow(report.ScannedAt) {
+			summary.Scans++
+			images[image] = true
+		}
+
+		present := make(map[string]bool)
+		for _, rules := range report.Matches {
+			for rule, matches := range rules {
+				for _, match := range matches {
+					present[image+"\x00"+rule+"\x00"+match] = true
+				}
+			}
+		}
+
+		for key := range present {
+			leak, ok := leaks[key]
+			if !ok {
+				leak = &leakState{firstSeen: report.ScannedAt}
+				leaks[key] = leak
+				if inWindow(report.ScannedAt) {
+					summary.NewLeaks++
+				}
+			}
+			if !leak.open {
+				leak.open = true
+				leak.openSince = report.ScannedAt
+			}
+			if inWindow(report.ScannedAt) {
+				if repoLeaks[report.SelectedRepo] == nil {
+					repoLeaks[report.SelectedRepo] = make(map[string]bool)
+				}
+				repoLeaks[report.SelectedRepo][key] = true
+			}
+		}
+		if report.Partial {
+			continue
+		}
+		for key, leak := range leaks {
+			if !leak.open || present[key] || !strings.HasPrefix(key, image+"\x00") {
+				continue
+			}
+			leak.open = false
+			if inWindow(report.ScannedAt) {
+				summary.ResolvedLeaks++
+				fixTimes = append(fixTimes, report.ScannedAt.Sub(leak.openSince))
+			}
+		}
+	}
+
+	for _, leak := range leaks {
+		if leak.open {
+			summary.OpenLeaks++
+		}
+	}
+	if len(fixTimes) > 0 {
+		var total time.Duration
+		for _, d := range fixTimes {
+			total += d
+		}
+		summary.MeanTimeToFix = total / time.Duration(len(fixTimes))
+	}
+	summary.Images = len(images)
+
+	for repo, keys := range repoLeaks {
+		summary.TopRepositories = append(summary.TopRepositories, repoLeakCount{Repo: repo, Leaks: len(keys)})
+	}
+	sort.Slice(summary.TopRepositories, func(i, j int) bool {
+		a, b := summary.TopRepositories[i], summary.TopRepositories[j]
+		if a.Leaks != b.Leaks {
+			return a.Leaks > b.Leaks
+		}
+		return a.Repo < b.Repo
+	})
+	if len(summary.TopRepositories) > 10 {
+		summary.TopRepositories = summary.TopRepositories[:10]
+	}
+	return summary
+}
+
+func formatComplianceMarkdown(s *complianceSummary) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# DockerSpy compliance report\n\n")
+	fmt.Fprintf(&buf, "Period: %s to %s\n\n", s.Since.Format("2006-01-02"), s.Until.Format("2006-01-02"))
+	fmt.Fprintf(&buf, "## Summary\n\n")
+	fmt.Fprintf(&buf, "| Metric | Value |\n|---|---|\n")
+	fmt.Fprintf(&buf, "| Scans | %d |\n", s.Scans)
+	fmt.Fprintf(&buf, "| Images scanned | %d |\n", s.Images)
+	fmt.Fprintf(&buf, "| New leaks | %d |\n", s.NewLeaks)
+	fmt.Fprintf(&buf, "| Leaks fixed | %d |\n", s.ResolvedLeaks)
+	fmt.Fprintf(&buf, "| Leaks still open | %d |\n", s.OpenLeaks)
+	if s.ResolvedLeaks > 0 {
+		fmt.Fprintf(&buf, "| Mean time to remediation | %s |\n", formatDays(s.MeanTimeToFix))
+	} else {
+		fmt.Fprintf(&buf, "| Mean time to remediation | n/a |\n")
+	}
+
+	fmt.Fprintf(&buf, "\n## Top offending repositories\n\n")
+	if len(s.TopRepositories) == 0 {
+		fmt.Fprintf(&buf, "No leaks found in this period.\n")
+		return buf.Bytes()
+	}
+	fmt.Fprintf(&buf, "| Repository | Leaks |\n|---|---|\n")
+	for _, repo := range s.TopRepositories {
+		fmt.Fprintf(&buf, "| %s | %d |\n", repo.Repo, repo.Leaks)
+	}
+	return buf.Bytes()
+}
+
+func formatDays(d time.Duration) string {
+	if d < 24*time.Hour {
+		return d.Round(time.Minute).String()
+	}
+	return fmt.Sprintf("%.1f days", d.Hours()/24)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"path/filepath"
+	"sort"
+)
+
+const compositionTopN = 20
+
+type Composition struct {
+	CompressedSize   int64              `json:"compressedSize"`
+	UncompressedSize int64              `json:"uncompressedSize"`
+	FileCount        int                `json:"fileCount"`
+	WastedBytes      int64              `json:"wastedBytes"`
+	Layers           []LayerComposition `json:"layers"`
+	LargestFiles     []ImageFile        `json:"largestFiles,omitempty"`
+	Duplicates       []DuplicateFileSet `json:"duplicates,omitempty"`
+	files            map[string][]ImageFile
+}
+
+type LayerComposition struct {
+	Digest           string `json:"digest"`
+	CompressedSize   int64  `json:"compressedSize"`
+	UncompressedSize int64  `json:"uncompressedSize"`
+	FileCount        int    `json:"fileCount"`
+}
+
+type ImageFile struct {
+	Path  string `json:"path"`
+	Layer string `json:"layer"`
+	Size  int64  `json:"size"`
+}
+
+// DuplicateFileSet is one file content stored more than once in the image.
+// WastedBytes counts every copy after the first.
+type DuplicateFileSet struct {
+	Digest      string      `json:"digest"`
+	Size        int64       `json:"size"`
+	WastedBytes int64       `json:"wastedBytes"`
+	Copies      []ImageFile `json:"copies"`
+}
+
+func newComposition() *Composition {
+	return &Composition{files: make(map[string][]ImageFile)}
+}
+
+func (c *Composition) addLayer(layer Descriptor, extractedDir string, files map[string]FileMeta) {
+	lc := LayerComposition{Digest: layer.Digest, CompressedSize: layer.Size}
+	for path, meta := range files {
+		rel, err := filepath.Rel(extractedDir, path)
+		if err != nil {
+			rel = path
+		}
+		file := ImageFile{Path: "/" + filepath.ToSlash(rel), Layer: layer.Digest, Size: meta.Size}
+		lc.UncompressedSize += meta.Size
+		lc.FileCount++
+		c.LargestFiles = append(c.LargestFiles, file)
+		if meta.Digest != "" && meta.Size > 0 {
+			c.files[meta.Digest] = append(c.files[meta.Digest], file)
+		}
+	}
+
+	c.Layers = append(c.Layers, lc)
+	c.CompressedSize += lc.CompressedSize
+	c.UncompressedSize += lc.UncompressedSize
+	c.FileCount += lc.FileCount
+}
+
+func (c *Composition) finish() {
+	sort.Slice(c.LargestFiles, func(i, j int) bool {
+		return c.LargestFiles[i].Size > c.LargestFiles[j].Size
+	})
+	if len(c.LargestFiles) > compositionTopN {
+		c.LargestFiles = c.LargestFiles[:compositionTopN]
+	}
+
+	for digest, copies := range c.files {
+		if len(copies) < 2 {
+			continue
+		}
+		wasted := copies[0].Size * int64(len(copies)-1)
+		c.Duplicates = append(c.Duplicates, DuplicateFileSet{Digest: digest, Size: copies[0].Size, WastedBytes: wasted, Copies: copies})
+		c.WastedBytes += wasted
+	}
+	sort.Slice(c.Duplicates, func(i, j int) bool {
+		return c.Duplicates[i].WastedBytes > c.Duplicates[j].WastedBytes
+	})
+	if len(c.Duplicates) > compositionTopN {
+		c.Duplicates = c.Duplicates[:compositionTopN]
+	}
+	c.files = nil
+}
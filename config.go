@@ -0,0 +1,284 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// appConfig holds the settings read from the config file. Values are layered:
+// built-in defaults, then the file, then DOCKERSPY_* environment variables,
+// then command-line flags.
+type appConfig struct {
+	RegexPatterns    string  `yaml:"regexPatterns" json:"regexPatterns"`
+	IgnoreExtensions string  `yaml:"ignoreExtensions" json:"ignoreExtensions"`
+	Sinks            string  `yaml:"sinks" json:"sinks"`
+	ExtendDefaults   bool    `yaml:"extendDefaults" json:"extendDefaults"`
+	Allowlist        string  `yaml:"allowlist" json:"allowlist"`
+	Placeholders     string  `yaml:"placeholders" json:"placeholders"`
+	Baseline         string  `yaml:"baseline" json:"baseline"`
+	SignKey          string  `yaml:"signKey" json:"signKey"`
+	Workdir          string  `yaml:"workdir" json:"workdir"`
+	Output           string  `yaml:"output" json:"output"`
+	Journal          string  `yaml:"journal" json:"journal"`
+	Concurrency      int     `yaml:"concurrency" json:"concurrency"`
+	MaxTags          *int    `yaml:"maxTags" json:"maxTags"`
+	MaxDuration      string  `yaml:"maxDuration" json:"maxDuration"`
+	ConnectTimeout   string  `yaml:"connectTimeout" json:"connectTimeout"`
+	RequestTimeout   string  `yaml:"requestTimeout" json:"requestTimeout"`
+	Timeout          string  `yaml:"timeout" json:"timeout"`
+	CacheTTL         string  `yaml:"cacheTTL" json:"cacheTTL"`
+	FailOn           string  `yaml:"failOn" json:"failOn"`
+	Profile          string  `yaml:"profile" json:"profile"`
+	Proxy            string  `yaml:"proxy" json:"proxy"`
+	Platform         string  `yaml:"platform" json:"platform"`
+	Locale           string  `yaml:"locale" json:"locale"`
+	RateLimit        float64 `yaml:"rateLimit" json:"rateLimit"`
+	CACert           string  `yaml:"caCert" json:"caCert"`
+	TLSMinVersion    string  `yaml:"tlsMinVersion" json:"tlsMinVersion"`
+	InsecureTLS      bool    `yaml:"insecureSkipVerify" json:"insecureSkipVerify"`
+	Username         string  `yaml:"-" json:"-"`
+	Password         string  `yaml:"-" json:"-"`
+	Hub              struct {
+		Username string `yaml:"username" json:"username"`
+		Token    string `yaml:"token" json:"token"`
+	} `yaml:"hub" json:"hub"`
+	Retention          retentionPolicy         `yaml:"retention" json:"retention"`
+	Registries         map[string]registryAuth `yaml:"registries" json:"registries"`
+	InsecureRegistries []string                `yaml:"insecureRegistries" json:"insecureRegistries"`
+	RegistryMirror     string                  `yaml:"registryMirror" json:"registryMirror"`
+}
+
+// registryAuth holds the credentials for one registry host.
+type registryAuth struct {
+	Username string `yaml:"username" json:"username"`
+	Password string `yaml:"password" json:"password"`
+}
+
+var settings = defaultAppConfig()
+
+// configDir is set by --config-dir and searched before any other location.
+var configDir string
+
+func defaultAppConfig() appConfig {
+	return appConfig{}
+}
+
+// configSearchDirs lists where regex_patterns.json, ignore_extensions.json
+// and sinks.json are looked up, most specific first.
+func configSearchDirs() []string {
+	var dirs []string
+	if configDir != "" {
+		dirs = append(dirs, configDir)
+	}
+	if dir, err := os.UserConfigDir(); err == nil {
+		dirs = append(dirs, filepath.Join(dir, "dockerspy"), filepath.Join(dir, "dockerspy", "configs"))
+	}
+	xdgDirs := os.Getenv("XDG_CONFIG_DIRS")
+	if xdgDirs == "" {
+		xdgDirs = "/etc/xdg"
+	}
+	for _, dir := range filepath.SplitList(xdgDirs) {
+		dirs = append(dirs, filepath.Join(dir, "dockerspy"))
+	}
+	if exe, err := os.Executable(); err == nil {
+		if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+			exe = resolved
+		}
+		dir := filepath.Dir(exe)
+		dirs = append(dirs, filepath.Join(dir, "configs"), filepath.Join(dir, "src", "configs"))
+	}
+	return append(dirs, "/etc/dockerspy/configs")
+}
+
+// resolveConfigFile returns path when it was configured explicitly, or the
+// first copy of name found in configSearchDirs. It returns "" when there is
+// none.
+func resolveConfigFile(path, name string) string {
+	if path != "" {
+		return path
+	}
+	for _, dir := range configSearchDirs() {
+		candidate := filepath.Join(dir, name)
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate
+		}
+	}
+	return ""
+}
+
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "dockerspy", "config.yaml")
+}
+
+// loadAppConfig reads path as YAML, or JSON when it ends in .json. A missing
+// file is only an error when the path was given explicitly.
+func loadAppConfig(path string, explicit bool) (appConfig, error) {
+	cfg := defaultAppConfig()
+	if path != "" {
+		data, err := os.ReadFile(path)
+		switch {
+		case err == nil:
+			if strings.HasSuffix(path, ".json") {
+				err = json.Unmarshal(data, &cfg)
+			} else {
+				err = yaml.Unmarshal(data, &cfg)
+			}
+			if err != nil {
+				return cfg, fmt.Errorf("failed to parse %s: %v", path, err)
+			}
+		case !os.IsNotExist(err) || explicit:
+			return cfg, err
+		}
+	}
+
+	envStrings := map[string]*string{
+		"DOCKERSPY_REGEX_PATTERNS":    &cfg.RegexPatterns,
+		"DOCKERSPY_IGNORE_EXTENSIONS": &cfg.IgnoreExtensions,
+		"DOCKERSPY_SINKS":             &cfg.Sinks,
+		"DOCKERSPY_ALLOWLIST":         &cfg.Allowlist,
+		"DOCKERSPY_PLACEHOLDERS":      &cfg.Placeholders,
+		"DOCKERSPY_BASELINE":          &cfg.Baseline,
+		"DOCKERSPY_SIGN_KEY":          &cfg.SignKey,
+		"DOCKERSPY_WORKDIR":           &cfg.Workdir,
+		"DOCKERSPY_OUTPUT":            &cfg.Output,
+		"DOCKERSPY_JOURNAL":           &cfg.Journal,
+		"DOCKERSPY_MAX_DURATION":      &cfg.MaxDuration,
+		"DOCKERSPY_CONNECT_TIMEOUT":   &cfg.ConnectTimeout,
+		"DOCKERSPY_REQUEST_TIMEOUT":   &cfg.RequestTimeout,
+		"DOCKERSPY_TIMEOUT":           &cfg.Timeout,
+		"DOCKERSPY_CACHE_TTL":         &cfg.CacheTTL,
+		"DOCKERSPY_FAIL_ON":           &cfg.FailOn,
+		"DOCKERSPY_PROFILE":           &cfg.Profile,
+		"DOCKERSPY_PROXY":             &cfg.Proxy,
+		"DOCKERSPY_PLATFORM":          &cfg.Platform,
+		"DOCKERSPY_LOCALE":            &cfg.Locale,
+		"DOCKERSPY_CA_CERT":           &cfg.CACert,
+		"DOCKERSPY_TLS_MIN_VERSION":   &cfg.TLSMinVersion,
+		"DOCKERSPY_USERNAME":          &cfg.Username,
+		"DOCKERSPY_PASSWORD":          &cfg.Password,
+		"DOCKERHUB_USERNAME":          &cfg.Hub.Username,
+		"DOCKERHUB_TOKEN":             &cfg.Hub.Token,
+		"DOCKERSPY_REGISTRY_MIRROR":   &cfg.RegistryMirror,
+	}
+	for env, field := range envStrings {
+		if value := os.Getenv(env); value != "" {
+			*field = value
+		}
+	}
+	if value := os.Getenv("DOCKERSPY_EXTEND_DEFAULTS"); value != "" {
+		extend, err := strconv.ParseBool(value)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid DOCKERSPY_EXTEND_DEFAULTS: %v", err)
+		}
+		cfg.ExtendDefaults = extend
+	}
+	if value := os.Getenv("DOCKERSPY_INSECURE_SKIP_VERIFY"); value != "" {
+		insecure, err := strconv.ParseBool(value)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid DOCKERSPY_INSECURE_SKIP_VERIFY: %v", err)
+		}
+		cfg.InsecureTLS = insecure
+	}
+	if value := os.Getenv("DOCKERSPY_RATE_LIMIT"); value != "" {
+		rateLimit, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid DOCKERSPY_RATE_LIMIT: %v", err)
+		}
+		cfg.RateLimit = rateLimit
+	}
+	if value := os.Getenv("DOCKERSPY_CONCURRENCY"); value != "" {
+		concurrency, err := strconv.Atoi(value)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid DOCKERSPY_CONCURRENCY: %v", err)
+		}
+		cfg.Concurrency = concurrency
+	}
+	return cfg, nil
+}
+
+// applyToFlags uses configured values as defaults for the flags the user did
+// not set on the command line.
+func (c appConfig) applyToFlags(flags *pflag.FlagSet) error {
+	values := map[string]string{
+		"workdir":         c.Workdir,
+		"output":          c.Output,
+		"journal":         c.Journal,
+		"max-duration":    c.MaxDuration,
+		"connect-timeout": c.ConnectTimeout,
+		"request-timeout": c.RequestTimeout,
+		"timeout":         c.Timeout,
+		"cache-ttl":       c.CacheTTL,
+		"fail-on":         c.FailOn,
+		"proxy":           c.Proxy,
+		"platform":        c.Platform,
+		"locale":          c.Locale,
+		"ca-cert":         c.CACert,
+		"tls-min-version": c.TLSMinVersion,
+		"sign-key":        c.SignKey,
+		"profile":         c.Profile,
+		"username":        c.Username,
+		"password":        c.Password,
+		"keep-findings":   c.Retention.Findings,
+		"keep-evidence":   c.Retention.Evidence,
+		"keep-cache":      c.Retention.Cache,
+		"registry-mirror": c.RegistryMirror,
+	}
+	if c.Concurrency > 0 {
+		values["concurrency"] = strconv.Itoa(c.Concurrency)
+	}
+	// 0 is a meaningful maxTags, so only a missing key leaves the default.
+	if c.MaxTags != nil {
+		values["max-tags"] = strconv.Itoa(*c.MaxTags)
+	}
+	if len(c.InsecureRegistries) > 0 {
+		values["insecure-registry"] = strings.Join(c.InsecureRegistries, ",")
+	}
+	if c.InsecureTLS {
+		values["insecure-skip-verify"] = "true"
+	}
+	if c.RateLimit > 0 {
+		values["rate-limit"] = strconv.FormatFloat(c.RateLimit, 'f', -1, 64)
+	}
+	for name, value := range values {
+		flag := flags.Lookup(name)
+		if value == "" || flag == nil || flag.Changed {
+			continue
+		}
+		if err := flag.Value.Set(value); err != nil {
+			return fmt.Errorf("invalid %s in config: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// proxyFunc routes every request through raw, or through HTTP_PROXY,
+// HTTPS_PROXY and NO_PROXY when raw is empty. SOCKS5 proxies resolve host
+// names on the proxy side, so lookups do not leak around Tor.
+func proxyFunc(raw string) (func(*http.Request) (*url.URL, error), error) {
+	if raw == "" {
+		return http.ProxyFromEnvironment, nil
+	}
+	proxyURL, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy: %v", err)
+	}
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("invalid proxy %q: scheme must be http, https, socks5 or socks5h", raw)
+	}
+	return http.ProxyURL(proxyURL), nil
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// DisclosureContact is someone to notify about a confirmed leak: an email
+// address or a link, with where it was found.
+type DisclosureContact struct {
+	Kind   string `json:"kind"`
+	Value  string `json:"value"`
+	Source string `json:"source"`
+}
+
+const (
+	contactEmail = "email"
+	contactURL   = "url"
+	contactHub   = "hub-profile"
+)
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`)
+	urlPattern   = regexp.MustCompile(`https?://[^\s"'<>]+`)
+)
+
+// contactLabels name the owner of an image or point at its source.
+var contactLabels = []string{
+	"maintainer",
+	"org.opencontainers.image.authors",
+	"org.opencontainers.image.vendor",
+	"org.opencontainers.image.source",
+	"org.opencontainers.image.url",
+	"org.opencontainers.image.documentation",
+	"org.label-schema.vcs-url",
+	"org.label-schema.url",
+	"vcs-url",
+}
+
+// contactFiles are the files projects use to say who to contact.
+var contactFiles = map[string]bool{
+	"security.txt": true,
+	"SECURITY.md":  true,
+	"CODEOWNERS":   true,
+	"MAINTAINERS":  true,
+}
+
+// isContactFile skips copies shipped inside dependencies, which name the
+// dependency's authors rather than the image owner.
+func isContactFile(rel string) bool {
+	slashed := "/" + strings.TrimPrefix(path.Clean("/"+rel), "/")
+	if !contactFiles[path.Base(slashed)] {
+		return false
+	}
+	for _, dir := range []string{"/node_modules/", "/site-packages/", "/dist-packages/", "/vendor/", "/usr/share/", "/usr/lib/", "/usr/local/lib/"} {
+		if strings.Contains(slashed, dir) {
+			return false
+		}
+	}
+	return true
+}
+
+// extractContacts finds email addresses and, when withURLs is set, links in
+// text. Documentation placeholders are left out.
+func extractContacts(text, source string, withURLs bool) []DisclosureContact {
+	var contacts []DisclosureContact
+	for _, email := range emailPattern.FindAllString(text, -1) {
+		domain := strings.ToLower(email[strings.LastIndex(email, "@")+1:])
+		if strings.HasPrefix(domain, "example.") || domain == "localhost" {
+			continue
+		}
+		contacts = append(contacts, DisclosureContact{Kind: contactEmail, Value: email, Source: source})
+	}
+	if withURLs {
+		for _, link := range urlPattern.FindAllString(text, -1) {
+			contacts = append(contacts, DisclosureContact{Kind: contactURL, Value: strings.TrimRight(link, ".,;)"), Source: source})
+		}
+	}
+	return contacts
+}
+
+func labelContacts(labels map[string]string) []DisclosureContact {
+	var contacts []DisclosureContact
+	for _, key := range contactLabels {
+		if value, ok := labels[key]; ok {
+			contacts = append(contacts, extractContacts(value, "label:"+key, true)...)
+		}
+	}
+	return contacts
+}
+
+// historyContacts reads the MAINTAINER instructions of the build history,
+// which labels() does not see when a later step overrode the author.
+func historyContacts(history []HistoryEntry) []DisclosureContact {
+	var contacts []DisclosureContact
+	for _, entry := range history {
+		if strings.Contains(entry.CreatedBy, "MAINTAINER") {
+			contacts = append(contacts, extractContacts(entry.CreatedBy, "history", false)...)
+		}
+	}
+	return contacts
+}
+
+// hubProfileContacts links the Docker Hub page of the image's namespace and
+// whatever the account publishes on its profile.
+func hubProfileContacts(repo string) []DisclosureContact {
+	namespace, _, _ := strings.Cut(hubRepoPath(repo), "/")
+	if namespace == "library" {
+		return []DisclosureContact{{Kind: contactURL, Value: "https://github.com/docker-library/official-images", Source: "hub:official-image"}}
+	}
+	contacts := []DisclosureContact{{Kind: contactHub, Value: "https://hub.docker.com/u/" + namespace, Source: "hub:namespace"}}
+
+	data, err := hubGet(fmt.Sprintf("https://hub.docker.com/v2/users/%s/", namespace), "get profile")
+	if err != nil {
+		data, err = hubGet(fmt.Sprintf("https://hub.docker.com/v2/orgs/%s/", namespace), "get profile")
+	}
+	if err != nil {
+		logger.Debug("could not read Hub profile", "namespace", namespace, "error", err)
+		return contacts
+	}
+	var profile struct {
+		FullName   string `json:"full_name"`
+		Company    string `json:"company"`
+		ProfileURL string `json:"profile_url"`
+	}
+	if err := json.Unmarshal(data, &profile); err != nil {
+		logger.Debug("could not parse Hub profile", "namespace", namespace, "error", err)
+		return contacts
+	}
+	if profile.ProfileURL != "" {
+		contacts = append(contacts, DisclosureContact{Kind: contactURL, Value: profile.ProfileURL, Source: "hub:profile"})
+	}
+	for _, field := range []string{profile.FullName, profile.Company} {
+		contacts = append(contacts, extractContacts(field, "hub:profile", false)...)
+	}
+	return contacts
+}
+
+// mergeContacts drops repeated addresses and links, keeping the first
+// source each was seen in, and lists emails first.
+func mergeContacts(contacts []DisclosureContact) []DisclosureContact {
+	seen := make(map[string]bool)
+	var merged []DisclosureContact
+	for _, contact := range contacts {
+		key := contact.Kind + "\x00" + strings.ToLower(contact.Value)
+		if !seen[key] {
+			seen[key] = true
+			merged = append(merged, contact)
+		}
+	}
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].Kind == contactEmail && merged[j].Kind != contactEmail
+	})
+	return merged
+}
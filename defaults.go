@@ -0,0 +1,37 @@
+package main
+
+import (
+	_ "embed"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Built-in rule sets, used when no regex_patterns.json or
+// ignore_extensions.json is found and extended by user files when
+// extendDefaults is set.
+
+//go:embed src/configs/regex_patterns.json
+var embeddedRegexPatterns []byte
+
+//go:embed src/configs/ignore_extensions.json
+var embeddedIgnoreExtensions []byte
+
+// builtinRules returns the rule set installed by `dockerspy update` when it
+// came from a newer release than this binary, or the one embedded in the
+// binary otherwise. Rules installed before an upgrade are older than the
+// binary's own and are left unused.
+func builtinRules(name string, embedded []byte) []byte {
+	dir := updatedRulesDir()
+	if dir == "" {
+		return embedded
+	}
+	installed, err := os.ReadFile(filepath.Join(dir, rulesVersionFile))
+	if err != nil || !newerVersion(strings.TrimSpace(string(installed)), version) {
+		return embedded
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, name)); err == nil {
+		return data
+	}
+	return embedded
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// remoteSinks deliver over the network and are retried when they fail.
+var remoteSinks = map[string]bool{"webhook": true, "slack": true, "elastic": true, "s3": true}
+
+const (
+	defaultSinkRetries = 3
+	maxSinkRetryDelay  = time.Minute
+)
+
+// sinkRetryDelay is the wait before the first retry; it doubles each time.
+var sinkRetryDelay = 2 * time.Second
+
+// sinkStatusError is a non-2xx answer from a sink endpoint.
+type sinkStatusError struct {
+	Code   int
+	Status string
+}
+
+func (e *sinkStatusError) Error() string {
+	return "sink responded with " + e.Status
+}
+
+// retryable reports whether err may go away on its own: network errors,
+// timeouts, rate limiting and server errors. Other 4xx answers will not.
+func retryable(err error) bool {
+	var statusErr *sinkStatusError
+	if !errors.As(err, &statusErr) {
+		return true
+	}
+	code := statusErr.Code
+	return code == http.StatusRequestTimeout || code == http.StatusTooManyRequests || code >= 500
+}
+
+// retryingSink retries a remote sink with exponential backoff and, when it
+// still fails, writes a dead letter so the reports can be redelivered.
+type retryingSink struct {
+	Sink
+	config SinkConfig
+}
+
+func (s *retryingSink) Emit(ctx context.Context, reports []*Report) error {
+	retries := s.config.Retries
+	if retries == 0 {
+		retries = defaultSinkRetries
+	}
+	delay := sinkRetryDelay
+	var err error
+	for attempt := 0; ; attempt++ {
+		if err = s.Sink.Emit(ctx, reports); err == nil {
+			return nil
+		}
+		// Once the run is stopped, what is left goes to the dead letters.
+		if attempt >= retries || !retryable(err) || ctx.Err() != nil {
+			break
+		}
+		logger.Warn("sink delivery failed, retrying", "sink", s.Name(), "error", err, "retryIn", delay)
+		if sleepContext(ctx, delay) != nil {
+			break
+		}
+		delay = min(delay*2, maxSinkRetryDelay)
+	}
+
+	path, dlErr := writeDeadLetter(s.config, reports, err)
+	if dlErr != nil {
+		return fmt.Errorf("%v; the reports could not be kept for redelivery either: %v", err, dlErr)
+	}
+	return fmt.Errorf("%v; kept for redelivery in %s", err, path)
+}
+
+// deadLetter is a failed delivery, with what is needed to retry it.
+type deadLetter struct {
+	Sink     SinkConfig `json:"sink"`
+	Error    string     `json:"error"`
+	FailedAt time.Time  `json:"failedAt"`
+	Reports  []*Report  `json:"reports"`
+}
+
+func deadLetterDir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "dockerspy", "deadletter")
+}
+
+// writeDeadLetter stores the failed delivery with owner-only permissions,
+// since sink URLs and headers often carry credentials.
+func writeDeadLetter(config SinkConfig, reports []*Report, cause error) (string, error) {
+	dir := deadLetterDir()
+	if dir == "" {
+		return "", fmt.Errorf("no user config directory")
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	data, err := json.MarshalIndent(deadLetter{Sink: config, Error: cause.Error(), FailedAt: time.Now().UTC(), Reports: reports}, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	file, err := os.CreateTemp(dir, fmt.Sprintf("%s-%d-*.json", config.Type, time.Now().Unix()))
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	if _, err := file.Write(data); err != nil {
+		return "", err
+	}
+	return file.Name(), nil
+}
+
+func listDeadLetters() ([]string, error) {
+	dir := deadLetterDir()
+	if dir == "" {
+		return nil, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	var paths []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".json") {
+			paths = append(paths, filepath.Join(dir, entry.Name()))
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// redeliver sends a dead letter to its sink once more and removes it on
+// success.
+func redeliver(ctx context.Context, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var letter deadLetter
+	if err := json.Unmarshal(data, &letter); err != nil {
+		return fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	factory, ok := sinkFactories[letter.Sink.Type]
+	if !ok {
+		return fmt.Errorf("unknown sink type: %s", letter.Sink.Type)
+	}
+	sink, err := factory(letter.Sink)
+	if err != nil {
+		return err
+	}
+	if err := sink.Emit(ctx, letter.Reports); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
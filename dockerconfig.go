@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// dockerConfigFile is the part of ~/.docker/config.json that docker login
+// writes. With a credential store or helper configured, auths only lists the
+// registries and the secrets live in the helper.
+type dockerConfigFile struct {
+	Auths       map[string]dockerAuthEntry `json:"auths"`
+	CredsStore  string                     `json:"credsStore"`
+	CredHelpers map[string]string          `json:"credHelpers"`
+}
+
+type dockerAuthEntry struct {
+	Auth     string `json:"auth"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+var (
+	dockerConfigOnce sync.Once
+	dockerConfig     *dockerConfigFile
+
+	// helperCredentials caches helper answers per registry, so a batch scan
+	// runs each helper once rather than once per image.
+	helperMu          sync.Mutex
+	helperCredentials = make(map[string][2]string)
+)
+
+func dockerConfigPath() string {
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		return filepath.Join(dir, "config.json")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".docker", "config.json")
+}
+
+// loadDockerConfig reads the docker CLI config once. A missing or broken
+// file just means there are no stored credentials.
+func loadDockerConfig() *dockerConfigFile {
+	dockerConfigOnce.Do(func() {
+		dockerConfig = &dockerConfigFile{}
+		path := dockerConfigPath()
+		if path == "" {
+			return
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return
+		}
+		if err := json.Unmarshal(data, dockerConfig); err != nil {
+			logger.Warn("could not parse docker config", "path", path, "error", err)
+		}
+	})
+	return dockerConfig
+}
+
+// dockerAuthRegistry normalizes a key of the auths section, which may be a
+// bare host or a URL such as https://index.docker.io/v1/.
+func dockerAuthRegistry(key string) string {
+	key = strings.TrimPrefix(strings.TrimPrefix(key, "https://"), "http://")
+	host, _, _ := strings.Cut(key, "/")
+	return parseImageReference(host + "/x").Registry
+}
+
+// dockerHubServerURL is the key docker login uses for Docker Hub.
+const dockerHubServerURL = "https://index.docker.io/v1/"
+
+// credentialHelperTimeout bounds a helper call, which may prompt a keychain
+// unlock or make a network round trip (ecr-login, gcloud).
+const credentialHelperTimeout = 30 * time.Second
+
+// dockerConfigCredentials returns what docker login stored for registry:
+// from the credential helper for the registry or the default credential
+// store when one is configured, from the auths section otherwise.
+func dockerConfigCredentials(registry string) (string, string) {
+	config := loadDockerConfig()
+	helper := config.CredsStore
+	for key, name := range config.CredHelpers {
+		if dockerAuthRegistry(key) == registry {
+			helper = name
+		}
+	}
+	if helper != "" {
+		helperMu.Lock()
+		creds, ok := helperCredentials[registry]
+		if !ok {
+			username, password, err := credentialHelperGet(helper, config.serverURL(registry))
+			if err != nil {
+				logger.Debug("credential helper has no credentials", "helper", helper, "registry", registry, "error", err)
+			}
+			creds = [2]string{username, password}
+			helperCredentials[registry] = creds
+		}
+		helperMu.Unlock()
+		if creds[0] != "" {
+			return creds[0], creds[1]
+		}
+	}
+
+	for key, entry := range config.Auths {
+		if dockerAuthRegistry(key) != registry {
+			continue
+		}
+		if entry.Auth == "" {
+			return entry.Username, entry.Password
+		}
+		decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
+		if err != nil {
+			logger.Warn("invalid auth in docker config", "registry", key, "error", err)
+			return "", ""
+		}
+		username, password, _ := strings.Cut(string(decoded), ":")
+		return username, password
+	}
+	return "", ""
+}
+
+// serverURL is the key registry was stored under by docker login.
+func (c *dockerConfigFile) serverURL(registry string) string {
+	if registry == dockerHubRegistry {
+		return dockerHubServerURL
+	}
+	for key := range c.Auths {
+		if dockerAuthRegistry(key) == registry {
+			return key
+		}
+	}
+	return registry
+}
+
+// credentialHelperGet runs docker-credential-<helper> get, the protocol
+// shared by osxkeychain, wincred, pass, ecr-login, gcloud and the rest.
+func credentialHelperGet(helper, serverURL string) (string, string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), credentialHelperTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "docker-credential-"+helper, "get")
+	cmd.Stdin = strings.NewReader(serverURL)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		// Helpers report a missing entry on stdout.
+		message := strings.TrimSpace(string(out) + stderr.String())
+		return "", "", fmt.Errorf("%v: %s", err, message)
+	}
+
+	var creds struct {
+		Username string `json:"Username"`
+		Secret   string `json:"Secret"`
+	}
+	if err := json.Unmarshal(out, &creds); err != nil {
+		return "", "", fmt.Errorf("unexpected output from docker-credential-%s: %v", helper, err)
+	}
+	if creds.Username == "<token>" {
+		return "", "", fmt.Errorf("docker-credential-%s holds an identity token, which is not supported", helper)
+	}
+	return creds.Username, creds.Secret, nil
+}
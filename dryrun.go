@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// previewImage prints what a scan of ref would download without
+// fetching any layer.
+func previewImage(ctx context.Context, ref imageRef) error {
+	session, err := newRegistrySession(ctx, ref)
+	if err != nil {
+		return err
+	}
+
+	manifest, err := getManifest(ctx, session, ref.reference(), ref.platform())
+	if err != nil {
+		return err
+	}
+
+	var total int64
+	for _, layer := range manifest.Layers {
+		total += layer.Size
+	}
+	if jsonOutput {
+		return printJSON(map[string]interface{}{
+			"image":     ref.String(),
+			"mediaType": manifest.MediaType,
+			"config":    manifest.Config,
+			"layers":    manifest.Layers,
+			"totalSize": total,
+		})
+	}
+
+	fmt.Printf("%s (%s)\n", ref, manifest.MediaType)
+	fmt.Printf("  config   %s  %s\n", manifest.Config.Digest, formatBytes(manifest.Config.Size))
+	for i, layer := range manifest.Layers {
+		fmt.Printf("  layer %-2d %s  %s\n", i+1, layer.Digest, formatBytes(layer.Size))
+	}
+	fmt.Printf("  total download: %s in %d layers\n", formatBytes(total), len(manifest.Layers))
+	return nil
+}
+
+func previewTargets(ctx context.Context, refs []string) error {
+	failed := 0
+	for _, ref := range refs {
+		if ctx.Err() != nil {
+			return stopped(ctx)
+		}
+		if err := previewImage(ctx, parseImageReference(ref)); err != nil {
+			logger.Error("error reading manifest", "image", ref, "error", err, "hint", errorHint(err))
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d manifests could not be read", failed, len(refs))
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// contentKey identifies image content by its ordered layer digests, which
+// stay the same however often an image is retagged or re-pushed.
+func contentKey(layers []string) string {
+	return strings.Join(layers, ",")
+}
+
+// linkDuplicates records in each report the images of other repositories
+// with exactly the same layers: from the same run and, when indexDir is
+// set, from every image indexed before. A leaked image re-published under
+// another name shows up this way.
+func linkDuplicates(reports []*Report, indexDir string) {
+	type image struct{ repo, name string }
+	byContent := make(map[string][]image)
+	add := func(layers []string, repo, name string) {
+		if len(layers) == 0 {
+			return
+		}
+		key := contentKey(layers)
+		for _, seen := range byContent[key] {
+			if seen.name == name {
+				return
+			}
+		}
+		byContent[key] = append(byContent[key], image{repo: repo, name: name})
+	}
+
+	for _, report := range reports {
+		if report.Inputs != nil {
+			add(report.Inputs.LayerDigests, report.SelectedRepo, reportImage(report))
+		}
+	}
+	if indexDir != "" {
+		err := forEachIndexedImage(indexDir, func(indexed IndexedImage) {
+			repo, _, _ := strings.Cut(indexed.Image, "@")
+			if i := strings.LastIndex(repo, ":"); i > strings.LastIndex(repo, "/") {
+				repo = repo[:i]
+			}
+			add(indexed.Layers, repo, indexed.Image)
+		})
+		if err != nil {
+			logger.Warn("could not read content index", "error", err)
+		}
+	}
+
+	for _, report := range reports {
+		if report.Inputs == nil || len(report.Inputs.LayerDigests) == 0 {
+			continue
+		}
+		var same []string
+		for _, other := range byContent[contentKey(report.Inputs.LayerDigests)] {
+			if other.repo != report.SelectedRepo {
+				same = append(same, other.name)
+			}
+		}
+		sort.Strings(same)
+		report.SameContent = same
+		if len(same) > 0 {
+			logger.Warn("same image content published under other names", "image", reportImage(report), "others", strings.Join(same, ","))
+		}
+	}
+}
+
+func reportImage(report *Report) string {
+	if report.Digest != "" {
+		return report.SelectedRepo + "@" + report.Digest
+	}
+	return report.SelectedRepo + ":" + report.SelectedTag
+}
+
+func forEachIndexedImage(dir string, fn func(IndexedImage)) error {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return err
+		}
+		var image IndexedImage
+		if err := json.Unmarshal(data, &image); err != nil {
+			logger.Warn("skipping unreadable index file", "file", entry.Name(), "error", err)
+			continue
+		}
+		fn(image)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// decodeContent transcodes file content to UTF-8 so detectors also see secrets
+// in UTF-16 files written on Windows and in legacy Latin-1 configs. It returns
+// the detected encoding alongside the text.
+func decodeContent(data []byte) (string, string) {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xEF, 0xBB, 0xBF}):
+		return string(data[3:]), "utf-8"
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}):
+		return decodeUTF16(data[2:], binary.LittleEndian), "utf-16le"
+	case bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		return decodeUTF16(data[2:], binary.BigEndian), "utf-16be"
+	}
+
+	if order := guessUTF16(data); order != nil {
+		if order == binary.ByteOrder(binary.LittleEndian) {
+			return decodeUTF16(data, order), "utf-16le"
+		}
+		return decodeUTF16(data, order), "utf-16be"
+	}
+
+	if utf8.Valid(data) {
+		return string(data), "utf-8"
+	}
+	return decodeLatin1(data), "latin-1"
+}
+
+// guessUTF16 looks for the zero high bytes that mostly-ASCII UTF-16 text
+// without a BOM has on every other position.
+func guessUTF16(data []byte) binary.ByteOrder {
+	if len(data) < 8 || len(data)%2 != 0 {
+		return nil
+	}
+
+	sample := data
+	if len(sample) > 4096 {
+		sample = sample[:4096]
+	}
+	var evenZeros, oddZeros int
+	for i := 0; i+1 < len(sample); i += 2 {
+		if sample[i] == 0 {
+			evenZeros++
+		}
+		if sample[i+1] == 0 {
+			oddZeros++
+		}
+	}
+
+	pairs := len(sample) / 2
+	switch {
+	case oddZeros*10 >= pairs*9 && evenZeros*10 < pairs:
+		return binary.LittleEndian
+	case evenZeros*10 >= pairs*9 && oddZeros*10 < pairs:
+		return binary.BigEndian
+	}
+	return nil
+}
+
+func decodeUTF16(data []byte, order binary.ByteOrder) string {
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = order.Uint16(data[i*2:])
+	}
+	return string(utf16.Decode(units))
+}
+
+func decodeLatin1(data []byte) string {
+	runes := make([]rune, len(data))
+	for i, b := range data {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
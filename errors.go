@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+type ErrorKind string
+
+const (
+	ErrAuthRequired      ErrorKind = "auth_required"
+	ErrForbidden         ErrorKind = "forbidden"
+	ErrRateLimited       ErrorKind = "rate_limited"
+	ErrNotFound          ErrorKind = "not_found"
+	ErrManifestList      ErrorKind = "manifest_list"
+	ErrUnsupportedFormat ErrorKind = "unsupported_format"
+	ErrDigestMismatch    ErrorKind = "digest_mismatch"
+	ErrServer            ErrorKind = "server_error"
+	ErrUnexpected        ErrorKind = "unexpected_response"
+	ErrHubSchema         ErrorKind = "hub_schema_changed"
+)
+
+var errorHints = map[ErrorKind]string{
+	ErrAuthRequired:      "the repository is private or requires credentials; pass --username with --password-stdin, add the registry under registries in the config file, or for Docker Hub set DOCKERHUB_USERNAME and DOCKERHUB_TOKEN (--hub-username, --hub-token)",
+	ErrForbidden:         "the credentials in use are not allowed to pull this repository",
+	ErrRateLimited:       "rate limit reached; wait a few minutes, slow down with --rate-limit, or log in to Docker Hub with DOCKERHUB_USERNAME and DOCKERHUB_TOKEN (--hub-token) to raise the limit",
+	ErrNotFound:          "check the repository name (official images live under library/) and that the tag exists",
+	ErrManifestList:      "the tag points to a multi-platform manifest list without the requested platform; pick another with --platform",
+	ErrUnsupportedFormat: "the registry returned a manifest format DockerSpy cannot parse",
+	ErrDigestMismatch:    "the downloaded blob does not match its manifest digest; the partial download was discarded, retry the scan",
+	ErrServer:            "the registry is having trouble; retry later",
+	ErrUnexpected:        "unexpected registry response",
+	ErrHubSchema:         "Docker Hub answered with a payload layout DockerSpy does not recognize; update DockerSpy",
+}
+
+type RegistryError struct {
+	Kind   ErrorKind
+	Op     string
+	Status string
+	Hint   string
+}
+
+func (e *RegistryError) Error() string {
+	if e.Status == "" {
+		return fmt.Sprintf("%s: %s", e.Op, e.Kind)
+	}
+	return fmt.Sprintf("%s: %s (%s)", e.Op, e.Kind, e.Status)
+}
+
+func newRegistryError(kind ErrorKind, op, status string) *RegistryError {
+	return &RegistryError{Kind: kind, Op: op, Status: status, Hint: errorHints[kind]}
+}
+
+func classifyResponse(resp *http.Response, op string) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	var kind ErrorKind
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized:
+		kind = ErrAuthRequired
+	case resp.StatusCode == http.StatusForbidden:
+		kind = ErrForbidden
+	case resp.StatusCode == http.StatusTooManyRequests:
+		kind = ErrRateLimited
+	case resp.StatusCode == http.StatusNotFound:
+		kind = ErrNotFound
+	case resp.StatusCode >= 500:
+		kind = ErrServer
+	default:
+		kind = ErrUnexpected
+	}
+	status := resp.Status
+	if kind == ErrRateLimited {
+		if wait, ok := retryAfter(resp.Header); ok {
+			status += fmt.Sprintf(", retry after %s", wait.Round(time.Second))
+		}
+		if remaining := resp.Header.Get("RateLimit-Remaining"); remaining != "" {
+			status += ", remaining " + remaining
+		}
+	}
+	return newRegistryError(kind, op, status)
+}
+
+func errorHint(err error) string {
+	var regErr *RegistryError
+	if errors.As(err, &regErr) {
+		return regErr.Hint
+	}
+	return ""
+}
+
+func isErrorKind(err error, kind ErrorKind) bool {
+	var regErr *RegistryError
+	return errors.As(err, &regErr) && regErr.Kind == kind
+}
+
+const (
+	exitFindings    = 2
+	exitInterrupted = 130
+)
+
+var errInterrupted = &exitError{code: exitInterrupted, err: errors.New("interrupted")}
+
+// stopped is the error a command ends with once ctx is done: interrupted by
+// a signal, or out of time when --timeout was set.
+func stopped(ctx context.Context) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return errors.New("overall --timeout reached, results are incomplete")
+	}
+	return errInterrupted
+}
+
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	whiteoutPrefix = ".wh."
+	whiteoutOpaque = ".wh..wh..opq"
+)
+
+// mergedEntry points at the tar entry that is visible in the final image:
+// the position-th entry of layer.
+type mergedEntry struct {
+	layer    int
+	position int
+}
+
+func cleanEntryName(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+func isUnder(name, dir string) bool {
+	return dir == "" || name == dir || strings.HasPrefix(name, dir+"/")
+}
+
+func forEachEntry(ctx context.Context, blobPath string, fn func(position int, header *tar.Header, r io.Reader) error) error {
+	layer, err := openLayer(blobPath)
+	if err != nil {
+		return err
+	}
+	defer layer.Close()
+
+	tarReader := tar.NewReader(layer)
+	for position := 0; ; position++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(position, header, tarReader); err != nil {
+			return err
+		}
+	}
+}
+
+// mergeLayers applies the layers in order, including whiteouts and opaque
+// directories, and returns which entry of which layer each visible path
+// comes from.
+func mergeLayers(ctx context.Context, blobPaths []string) (map[string]mergedEntry, error) {
+	entries := make(map[string]mergedEntry)
+	for i, blobPath := range blobPaths {
+		// Whiteouts only hide lower layers, never entries of their own layer.
+		removeLower := func(dir string, keepSelf bool) {
+			for name, entry := range entries {
+				if entry.layer < i && isUnder(name, dir) && (!keepSelf || name != dir) {
+					delete(entries, name)
+				}
+			}
+		}
+		err := forEachEntry(ctx, blobPath, func(position int, header *tar.Header, r io.Reader) error {
+			name := cleanEntryName(header.Name)
+			dir, base := path.Split(name)
+			dir = strings.TrimSuffix(dir, "/")
+			switch {
+			case base == whiteoutOpaque:
+				removeLower(dir, true)
+			case strings.HasPrefix(base, whiteoutPrefix):
+				removeLower(path.Join(dir, strings.TrimPrefix(base, whiteoutPrefix)), false)
+			case name != "":
+				// A file or link replacing a lower directory hides its
+				// contents too.
+				if header.Typeflag != tar.TypeDir {
+					removeLower(name, true)
+				}
+				entries[name] = mergedEntry{layer: i, position: position}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+type exportWriter interface {
+	add(name string, header *tar.Header, r io.Reader) error
+	Close() error
+}
+
+// exportImage writes the final filesystem of the image made of blobPaths to
+// output: a directory, or a tarball when output ends in .tar, .tar.gz or
+// .tgz.
+func exportImage(ctx context.Context, blobPaths []string, output string) error {
+	entries, err := mergeLayers(ctx, blobPaths)
+	if err != nil {
+		return err
+	}
+
+	var w exportWriter
+	switch {
+	case strings.HasSuffix(output, ".tar"), strings.HasSuffix(output, ".tar.gz"), strings.HasSuffix(output, ".tgz"):
+		w, err = newTarExport(output)
+	default:
+		w, err = newDirExport(output)
+	}
+	if err != nil {
+		return err
+	}
+
+	for i, blobPath := range blobPaths {
+		err := forEachEntry(ctx, blobPath, func(position int, header *tar.Header, r io.Reader) error {
+			name := cleanEntryName(header.Name)
+			if entry, ok := entries[name]; !ok || entry != (mergedEntry{layer: i, position: position}) {
+				return nil
+			}
+			return w.add(name, header, r)
+		})
+		if err != nil {
+			w.Close()
+			return err
+		}
+	}
+	return w.Close()
+}
+
+type tarExport struct {
+	file *os.File
+	gz   *gzip.Writer
+	tw   *tar.Writer
+}
+
+func newTarExport(output string) (*tarExport, error) {
+	file, err := os.Create(output)
+	if err != nil {
+		return nil, err
+	}
+	e := &tarExport{file: file}
+	if strings.HasSuffix(output, ".tar") {
+		e.tw = tar.NewWriter(file)
+	} else {
+		e.gz = gzip.NewWriter(file)
+		e.tw = tar.NewWriter(e.gz)
+	}
+	return e, nil
+}
+
+func (e *tarExport) add(name string, header *tar.Header, r io.Reader) error {
+	copied := *header
+	copied.Name = name
+	if header.Typeflag == tar.TypeLink {
+		copied.Linkname = cleanEntryName(header.Linkname)
+	}
+	if err := e.tw.WriteHeader(&copied); err != nil {
+		return err
+	}
+	_, err := io.Copy(e.tw, r)
+	return err
+}
+
+func (e *tarExport) Close() error {
+	err := e.tw.Close()
+	if e.gz != nil {
+		if gzErr := e.gz.Close(); err == nil {
+			err = gzErr
+		}
+	}
+	if closeErr := e.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+type dirExport struct {
+	root string
+}
+
+func newDirExport(output string) (*dirExport, error) {
+	if err := os.MkdirAll(output, 0o755); err != nil {
+		return nil, err
+	}
+	return &dirExport{root: output}, nil
+}
+
+// target maps name into the export directory, refusing paths whose parent
+// is a symlink: following it could write outside the directory.
+func (e *dirExport) target(name string) (string, bool) {
+	current := e.root
+	parts := strings.Split(name, "/")
+	for _, part := range parts[:len(parts)-1] {
+		current = filepath.Join(current, part)
+		info, err := os.Lstat(current)
+		if err == nil && info.Mode()&os.ModeSymlink != 0 {
+			return "", false
+		}
+	}
+	return filepath.Join(e.root, filepath.FromSlash(name)), true
+}
+
+func (e *dirExport) add(name string, header *tar.Header, r io.Reader) error {
+	target, ok := e.target(name)
+	if !ok {
+		logger.Warn("skipping entry below a symlink", "path", name)
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+	mode := os.FileMode(header.Mode).Perm() | 0o200
+
+	switch header.Typeflag {
+	case tar.TypeDir:
+		if err := os.MkdirAll(target, mode|0o700); err != nil {
+			return err
+		}
+	case tar.TypeReg:
+		os.Remove(target)
+		file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(file, r); err != nil {
+			file.Close()
+			return err
+		}
+		if err := file.Close(); err != nil {
+			return err
+		}
+	case tar.TypeSymlink:
+		os.Remove(target)
+		return os.Symlink(header.Linkname, target)
+	case tar.TypeLink:
+		source, ok := e.target(cleanEntryName(header.Linkname))
+		if !ok {
+			return nil
+		}
+		os.Remove(target)
+		if err := os.Link(source, target); err != nil {
+			logger.Debug("could not create hard link", "path", name, "target", header.Linkname, "error", err)
+		}
+		return nil
+	default:
+		return nil
+	}
+	os.Chtimes(target, header.ModTime, header.ModTime)
+	return nil
+}
+
+func (e *dirExport) Close() error {
+	return nil
+}
+
+// fetchLayers downloads every layer of ref into the blob cache and returns
+// their paths in order.
+func fetchLayers(ctx context.Context, blobs BlobStore, ref imageRef) ([]string, error) {
+	session, err := newRegistrySession(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := getManifest(ctx, session, ref.reference(), ref.platform())
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for _, layer := range manifest.Layers {
+		if !isTarLayer(layer.MediaType) {
+			logger.Warn("skipping layer that is not a filesystem", "digest", layer.Digest, "mediaType", layer.MediaType)
+			continue
+		}
+		logger.Info("downloading layer", "digest", layer.Digest, "size", layer.Size)
+		path, err := blobs.Fetch(ctx, session, layer)
+		if err != nil && ctx.Err() == nil && isForeignLayer(layer.MediaType) {
+			logger.Warn("skipping foreign layer that could not be downloaded", "digest", layer.Digest, "error", err)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to download layer %s: %w", layer.Digest, err)
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"archive/tar"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type tarEntry struct {
+	name     string
+	typeflag byte
+	linkname string
+	body     string
+}
+
+func writeLayer(t *testing.T, dir, name string, entries []tarEntry) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	tw := tar.NewWriter(file)
+	for _, entry := range entries {
+		header := &tar.Header{Name: entry.name, Typeflag: entry.typeflag, Linkname: entry.linkname, Mode: 0o644, Size: int64(len(entry.body))}
+		if entry.typeflag == tar.TypeDir {
+			header.Mode = 0o755
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(entry.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestDirectoryReplacedBySymlink(t *testing.T) {
+	dir := t.TempDir()
+	layers := []string{
+		writeLayer(t, dir, "0.tar", []tarEntry{
+			{name: "etc/", typeflag: tar.TypeDir},
+			{name: "etc/app/", typeflag: tar.TypeDir},
+			{name: "etc/app/secret.conf", typeflag: tar.TypeReg, body: "password=hunter2"},
+		}),
+		writeLayer(t, dir, "1.tar", []tarEntry{
+			{name: "etc/app", typeflag: tar.TypeSymlink, linkname: "/opt/app"},
+		}),
+	}
+
+	entries, err := mergeLayers(context.Background(), layers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := entries["etc/app/secret.conf"]; ok {
+		t.Error("file under the replaced directory is still visible")
+	}
+	if entry := entries["etc/app"]; entry.layer != 1 {
+		t.Errorf("etc/app comes from layer %d, want 1", entry.layer)
+	}
+
+	output := filepath.Join(dir, "rootfs")
+	if err := exportImage(context.Background(), layers, output); err != nil {
+		t.Fatal(err)
+	}
+	if link, err := os.Readlink(filepath.Join(output, "etc", "app")); err != nil || link != "/opt/app" {
+		t.Errorf("etc/app = %q, %v; want a symlink to /opt/app", link, err)
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	fileTypeTopN = 20
+	// An extension or directory is suggested for the ignore list once it
+	// takes this share of the scan time without producing a single match.
+	suggestIgnoreShare = 0.05
+	// Directories are tallied by their first components, such as
+	// /usr/share/doc.
+	dirPrefixDepth = 3
+)
+
+// FileTypeStats shows where scan time went and where matches came from,
+// per file extension and per directory, to help tune ignore_extensions.json.
+type FileTypeStats struct {
+	ScanTime             time.Duration  `json:"scanTime"`
+	Types                []FileTypeStat `json:"types"`
+	Paths                []PathStat     `json:"paths,omitempty"`
+	SuggestedIgnore      []string       `json:"suggestedIgnore,omitempty"`
+	SuggestedIgnorePaths []string       `json:"suggestedIgnorePaths,omitempty"`
+	byExtension          map[string]*FileTypeStat
+	byPath               map[string]*PathStat
+}
+
+// FileTypeStat covers every file with one extension. Skipped files were on
+// the ignore list and cost no scan time.
+type FileTypeStat struct {
+	Extension string        `json:"extension"`
+	Files     int           `json:"files"`
+	Skipped   int           `json:"skipped,omitempty"`
+	Bytes     int64         `json:"bytes"`
+	ScanTime  time.Duration `json:"scanTime"`
+	Matches   int           `json:"matches"`
+}
+
+// PathStat covers the scanned files under one directory prefix.
+type PathStat struct {
+	Path     string        `json:"path"`
+	Files    int           `json:"files"`
+	Bytes    int64         `json:"bytes"`
+	ScanTime time.Duration `json:"scanTime"`
+	Matches  int           `json:"matches"`
+}
+
+// fileTally is what one layer adds to FileTypeStats.
+type fileTally struct {
+	extensions map[string]*FileTypeStat
+	paths      map[string]*PathStat
+}
+
+func newFileTally() *fileTally {
+	return &fileTally{extensions: make(map[string]*FileTypeStat), paths: make(map[string]*PathStat)}
+}
+
+func fileExtension(path string) string {
+	if ext := strings.ToLower(filepath.Ext(path)); ext != "" {
+		return ext
+	}
+	return "(none)"
+}
+
+// dirPrefix is the directory rel is tallied under, or "" for files at the
+// root of the layer.
+func dirPrefix(rel string) string {
+	dir := path.Dir(filepath.ToSlash(rel))
+	if dir == "." || dir == "/" {
+		return ""
+	}
+	parts := strings.Split(strings.TrimPrefix(dir, "/"), "/")
+	return "/" + strings.Join(parts[:min(len(parts), dirPrefixDepth)], "/")
+}
+
+// recordFileType adds one file to the tally, creating its entries when
+// needed. rel is the file's path inside the layer.
+func recordFileType(tally *fileTally, rel string, size int64, skipped bool, elapsed time.Duration, matches map[string][]string) {
+	count := 0
+	for _, found := range matches {
+		count += len(found)
+	}
+
+	ext := fileExtension(rel)
+	stat := tally.extensions[ext]
+	if stat == nil {
+		stat = &FileTypeStat{Extension: ext}
+		tally.extensions[ext] = stat
+	}
+	stat.Files++
+	stat.Bytes += size
+	if skipped {
+		stat.Skipped++
+	}
+	stat.ScanTime += elapsed
+	stat.Matches += count
+
+	dir := dirPrefix(rel)
+	if skipped || dir == "" {
+		return
+	}
+	pathStat := tally.paths[dir]
+	if pathStat == nil {
+		pathStat = &PathStat{Path: dir}
+		tally.paths[dir] = pathStat
+	}
+	pathStat.Files++
+	pathStat.Bytes += size
+	pathStat.ScanTime += elapsed
+	pathStat.Matches += count
+}
+
+func newFileTypeStats() *FileTypeStats {
+	return &FileTypeStats{byExtension: make(map[string]*FileTypeStat), byPath: make(map[string]*PathStat)}
+}
+
+// addLayer adds a layer's tally. Scan time is only counted when the layer
+// was scanned, not when its results came from the layer cache, so shared
+// base layers do not count the earlier scan's time again.
+func (s *FileTypeStats) addLayer(tally *fileTally, scanned bool) {
+	elapsed := func(d time.Duration) time.Duration {
+		if scanned {
+			return d
+		}
+		return 0
+	}
+	for dir, layerStat := range tally.paths {
+		stat := s.byPath[dir]
+		if stat == nil {
+			stat = &PathStat{Path: dir}
+			s.byPath[dir] = stat
+		}
+		stat.Files += layerStat.Files
+		stat.Bytes += layerStat.Bytes
+		stat.ScanTime += elapsed(layerStat.ScanTime)
+		stat.Matches += layerStat.Matches
+	}
+	for ext, layerStat := range tally.extensions {
+		stat := s.byExtension[ext]
+		if stat == nil {
+			stat = &FileTypeStat{Extension: ext}
+			s.byExtension[ext] = stat
+		}
+		stat.Files += layerStat.Files
+		stat.Skipped += layerStat.Skipped
+		stat.Bytes += layerStat.Bytes
+		stat.ScanTime += elapsed(layerStat.ScanTime)
+		stat.Matches += layerStat.Matches
+		s.ScanTime += elapsed(layerStat.ScanTime)
+	}
+}
+
+// finish keeps the most expensive extensions and directories and suggests
+// ignoring those that cost a noticeable share of the time and never matched.
+func (s *FileTypeStats) finish(ignoreExtensions []string) {
+	ignored := make(map[string]bool, len(ignoreExtensions))
+	for _, ext := range ignoreExtensions {
+		ignored[strings.ToLower(ext)] = true
+	}
+	costly := func(elapsed time.Duration) bool {
+		return s.ScanTime > 0 && float64(elapsed) >= suggestIgnoreShare*float64(s.ScanTime)
+	}
+	for ext, stat := range s.byExtension {
+		s.Types = append(s.Types, *stat)
+		if stat.Matches == 0 && !ignored[ext] && ext != "(none)" && costly(stat.ScanTime) {
+			s.SuggestedIgnore = append(s.SuggestedIgnore, ext)
+		}
+	}
+	for dir, stat := range s.byPath {
+		s.Paths = append(s.Paths, *stat)
+		if stat.Matches == 0 && costly(stat.ScanTime) {
+			s.SuggestedIgnorePaths = append(s.SuggestedIgnorePaths, dir)
+		}
+	}
+	sort.Slice(s.Types, func(i, j int) bool {
+		return s.Types[i].ScanTime > s.Types[j].ScanTime
+	})
+	if len(s.Types) > fileTypeTopN {
+		s.Types = s.Types[:fileTypeTopN]
+	}
+	sort.Slice(s.Paths, func(i, j int) bool {
+		return s.Paths[i].ScanTime > s.Paths[j].ScanTime
+	})
+	if len(s.Paths) > fileTypeTopN {
+		s.Paths = s.Paths[:fileTypeTopN]
+	}
+	sort.Slice(s.SuggestedIgnore, func(i, j int) bool {
+		return s.byExtension[s.SuggestedIgnore[i]].ScanTime > s.byExtension[s.SuggestedIgnore[j]].ScanTime
+	})
+	sort.Slice(s.SuggestedIgnorePaths, func(i, j int) bool {
+		return s.byPath[s.SuggestedIgnorePaths[i]].ScanTime > s.byPath[s.SuggestedIgnorePaths[j]].ScanTime
+	})
+	s.byExtension = nil
+	s.byPath = nil
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"sort"
+	"strings"
+)
+
+// HeatMap counts findings per repository and rule across a sweep, with both
+// axes ranked by their totals.
+type HeatMap struct {
+	Repos      []string                  `json:"repos"`
+	Rules      []string                  `json:"rules"`
+	Counts     map[string]map[string]int `json:"counts"`
+	RepoTotals map[string]int            `json:"repoTotals"`
+	RuleTotals map[string]int            `json:"ruleTotals"`
+	Images     int                       `json:"images"`
+	// Highest is the largest single count, which the HTML shading scales to.
+	Highest int `json:"-"`
+}
+
+// buildHeatMap uses the latest report of each image, so a history of
+// repeated sweeps does not count the same leak once per run. namespace, when
+// set, keeps only repositories under it.
+func buildHeatMap(reports []*Report, namespace string) *HeatMap {
+	latest := make(map[string]*Report)
+	for _, report := range reports {
+		if namespace != "" && !strings.HasPrefix(report.SelectedRepo, strings.TrimSuffix(namespace, "/")+"/") {
+			continue
+		}
+		image := reportImage(report)
+		if previous, ok := latest[image]; !ok || report.ScannedAt.After(previous.ScannedAt) {
+			latest[image] = report
+		}
+	}
+
+	h := &HeatMap{Counts: make(map[string]map[string]int), RepoTotals: make(map[string]int), RuleTotals: make(map[string]int), Images: len(latest)}
+	for _, report := range latest {
+		for _, patterns := range report.Matches {
+			for rule, matched := range patterns {
+				if h.Counts[report.SelectedRepo] == nil {
+					h.Counts[report.SelectedRepo] = make(map[string]int)
+				}
+				h.Counts[report.SelectedRepo][rule] += len(matched)
+				h.RepoTotals[report.SelectedRepo] += len(matched)
+				h.RuleTotals[rule] += len(matched)
+			}
+		}
+	}
+	h.rank()
+	return h
+}
+
+// rank orders both axes by their totals and records the highest count.
+func (h *HeatMap) rank() {
+	h.Repos = rankByTotal(h.RepoTotals)
+	h.Rules = rankByTotal(h.RuleTotals)
+	h.Highest = 0
+	for _, counts := range h.Counts {
+		for _, count := range counts {
+			h.Highest = max(h.Highest, count)
+		}
+	}
+}
+
+func rankByTotal(totals map[string]int) []string {
+	keys := make([]string, 0, len(totals))
+	for key := range totals {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if totals[keys[i]] != totals[keys[j]] {
+			return totals[keys[i]] > totals[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
+// top keeps the first n repositories; n <= 0 keeps all of them. Rule
+// totals then only count the repositories kept.
+func (h *HeatMap) top(n int) *HeatMap {
+	if n <= 0 || len(h.Repos) <= n {
+		return h
+	}
+	trimmed := &HeatMap{Counts: make(map[string]map[string]int), RepoTotals: make(map[string]int), RuleTotals: make(map[string]int), Images: h.Images}
+	for _, repo := range h.Repos[:n] {
+		trimmed.Counts[repo] = h.Counts[repo]
+		trimmed.RepoTotals[repo] = h.RepoTotals[repo]
+		for rule, count := range h.Counts[repo] {
+			trimmed.RuleTotals[rule] += count
+		}
+	}
+	trimmed.rank()
+	return trimmed
+}
+
+func formatHeatMapText(h *HeatMap) []byte {
+	var buf bytes.Buffer
+	if len(h.Repos) == 0 {
+		fmt.Fprintf(&buf, "No findings in %d images.\n", h.Images)
+		return buf.Bytes()
+	}
+	fmt.Fprintf(&buf, "Findings by repository (%d images)\n\n", h.Images)
+	width := len("Repository")
+	for _, repo := range h.Repos {
+		width = max(width, len(repo))
+	}
+	fmt.Fprintf(&buf, "%-4s %-*s %8s  %s\n", "#", width, "Repository", "Findings", "Top rules")
+	for i, repo := range h.Repos {
+		rules := rankByTotal(h.Counts[repo])
+		var top []string
+		for _, rule := range rules[:min(3, len(rules))] {
+			top = append(top, fmt.Sprintf("%s (%d)", rule, h.Counts[repo][rule]))
+		}
+		fmt.Fprintf(&buf, "%-4d %-*s %8d  %s\n", i+1, width, repo, h.RepoTotals[repo], strings.Join(top, ", "))
+	}
+
+	fmt.Fprintf(&buf, "\nFindings by rule\n\n")
+	for i, rule := range h.Rules {
+		repos := 0
+		for _, counts := range h.Counts {
+			if counts[rule] > 0 {
+				repos++
+			}
+		}
+		fmt.Fprintf(&buf, "%-4d %-30s %8d  %s, %d repositories\n", i+1, rule, h.RuleTotals[rule], ruleSeverity(rule), repos)
+	}
+	return buf.Bytes()
+}
+
+var heatMapTemplate = template.Must(template.New("heatmap").Funcs(template.FuncMap{
+	"cell": func(h *HeatMap, repo, rule string) int { return h.Counts[repo][rule] },
+	"shade": func(h *HeatMap, repo, rule string) template.CSS {
+		count := h.Counts[repo][rule]
+		if count == 0 || h.Highest == 0 {
+			return "background:#fff"
+		}
+		return template.CSS(fmt.Sprintf("background:rgba(220,38,38,%.2f)", 0.15+0.85*float64(count)/float64(h.Highest)))
+	},
+}).Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>DockerSpy heat map</title>
+<style>
+body{font-family:sans-serif;margin:2em}
+table{border-collapse:collapse}
+th,td{border:1px solid #ddd;padding:4px 8px;text-align:right}
+th.repo,td.repo{text-align:left}
+th.rule{writing-mode:vertical-rl;transform:rotate(180deg);text-align:left}
+</style></head><body>
+<h1>Findings heat map</h1>
+<p>{{len .Repos}} repositories with findings across {{.Images}} images.</p>
+<table>
+<tr><th class="repo">Repository</th><th>Total</th>{{range .Rules}}<th class="rule">{{.}}</th>{{end}}</tr>
+{{$h := .}}{{range $repo := .Repos}}<tr><td class="repo">{{$repo}}</td><td>{{index $h.RepoTotals $repo}}</td>{{range $rule := $h.Rules}}<td style="{{shade $h $repo $rule}}">{{with cell $h $repo $rule}}{{.}}{{end}}</td>{{end}}</tr>
+{{end}}<tr><th class="repo">Total</th><th></th>{{range .Rules}}<th>{{index $h.RuleTotals .}}</th>{{end}}</tr>
+</table>
+</body></html>
+`))
+
+func formatHeatMapHTML(h *HeatMap) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := heatMapTemplate.Execute(&buf, h); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type httpOptions struct {
+	maxIdleConnsPerHost int
+	maxConnsPerHost     int
+	idleConnTimeout     time.Duration
+	disableKeepAlives   bool
+	disableHTTP2        bool
+	connectTimeout      time.Duration
+	requestTimeout      time.Duration
+	rateLimit           float64
+	retry               retryPolicy
+	proxy               func(*http.Request) (*url.URL, error)
+	tlsConfig           *tls.Config
+}
+
+var defaultHTTPOptions = httpOptions{
+	maxIdleConnsPerHost: 16,
+	idleConnTimeout:     90 * time.Second,
+	connectTimeout:      30 * time.Second,
+	requestTimeout:      2 * time.Minute,
+	retry:               defaultRetryPolicy,
+	proxy:               http.ProxyFromEnvironment,
+}
+
+// httpClient is shared by every registry, Hub and sink request so that
+// parallel scans reuse connections, and gives up on any request that takes
+// longer than the request timeout. downloadClient shares its connections but
+// has no overall limit, since a large layer can legitimately take hours;
+// downloads are abandoned when they stall instead. Both are safe for
+// concurrent use; replace them with configureHTTPClient before any request
+// is made.
+var (
+	httpClient, downloadClient = newHTTPClients(defaultHTTPOptions)
+	stallTimeout               = defaultHTTPOptions.requestTimeout
+)
+
+func newHTTPClients(opts httpOptions) (*http.Client, *http.Client) {
+	tlsConfig := opts.tlsConfig
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+
+	transport := &http.Transport{
+		Proxy: opts.proxy,
+		DialContext: (&net.Dialer{
+			Timeout:   opts.connectTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   opts.maxIdleConnsPerHost,
+		MaxConnsPerHost:       opts.maxConnsPerHost,
+		IdleConnTimeout:       opts.idleConnTimeout,
+		TLSHandshakeTimeout:   opts.connectTimeout,
+		ResponseHeaderTimeout: opts.requestTimeout,
+		ExpectContinueTimeout: time.Second,
+		TLSClientConfig:       tlsConfig,
+		DisableKeepAlives:     opts.disableKeepAlives,
+	}
+	if opts.disableHTTP2 {
+		// A non-nil empty map is how net/http is told not to negotiate h2.
+		transport.ForceAttemptHTTP2 = false
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	// Both clients share the limiter so downloads count against the rate.
+	var limiter *rateLimiter
+	if opts.rateLimit > 0 {
+		limiter = newRateLimiter(opts.rateLimit)
+	}
+	chain := func(base http.RoundTripper) http.RoundTripper {
+		if opts.rateLimit > 0 {
+			base = &limitedTransport{base: base, limiter: limiter}
+		}
+		// Always installed: with --retries 0 it still waits out 429s.
+		return &retryTransport{base: base, policy: opts.retry}
+	}
+	// API requests get the request timeout per attempt rather than as a
+	// client Timeout, which would also cover rate limiter and Retry-After
+	// waits and cut them short.
+	var api http.RoundTripper = transport
+	if opts.requestTimeout > 0 {
+		api = &deadlineTransport{base: transport, timeout: opts.requestTimeout}
+	}
+	return &http.Client{Transport: chain(api)}, &http.Client{Transport: chain(transport)}
+}
+
+// deadlineTransport gives each request attempt, including reading its
+// response body, at most timeout.
+type deadlineTransport struct {
+	base    http.RoundTripper
+	timeout time.Duration
+}
+
+func (t *deadlineTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(req.Context(), t.timeout)
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// tlsConfigFor trusts the certificates in caFile on top of the system roots
+// and enforces minVersion ("1.0" to "1.3"). insecure turns verification off
+// entirely, for lab registries with self-signed certificates.
+func tlsConfigFor(caFile string, insecure bool, minVersion string) (*tls.Config, error) {
+	config := &tls.Config{InsecureSkipVerify: insecure}
+	switch minVersion {
+	case "1.0":
+		config.MinVersion = tls.VersionTLS10
+	case "1.1":
+		config.MinVersion = tls.VersionTLS11
+	case "", "1.2":
+		config.MinVersion = tls.VersionTLS12
+	case "1.3":
+		config.MinVersion = tls.VersionTLS13
+	default:
+		return nil, fmt.Errorf("invalid TLS version %q: use 1.0, 1.1, 1.2 or 1.3", minVersion)
+	}
+
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no PEM certificates found in %s", caFile)
+		}
+		config.RootCAs = pool
+	}
+	return config, nil
+}
+
+func configureHTTPClient(opts httpOptions) {
+	httpClient, downloadClient = newHTTPClients(opts)
+	stallTimeout = opts.requestTimeout
+	registryRetry = opts.retry
+}
+
+// rateLimiter spaces requests evenly at a fixed rate. It is shared by every
+// client so concurrent scans together stay under the limit.
+type rateLimiter struct {
+	interval time.Duration
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+func newRateLimiter(perSecond float64) *rateLimiter {
+	return &rateLimiter{interval: time.Duration(float64(time.Second) / perSecond)}
+}
+
+// wait blocks until the caller may send its request or ctx is done.
+func (l *rateLimiter) wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	slot := l.next
+	if slot.Before(now) {
+		slot = now
+	}
+	l.next = slot.Add(l.interval)
+	l.mu.Unlock()
+
+	delay := slot.Sub(now)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type limitedTransport struct {
+	base    http.RoundTripper
+	limiter *rateLimiter
+}
+
+func (t *limitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.limiter.wait(req.Context()); err != nil {
+		return nil, err
+	}
+	return t.base.RoundTrip(req)
+}
+
+var errDownloadStalled = errors.New("download stalled")
+
+// errDownloadInterrupted marks a blob body that broke off after the
+// response arrived, which only a resumed download can recover from.
+var errDownloadInterrupted = errors.New("download interrupted")
+
+// stallGuard wraps a response body and calls cancel when no data arrives
+// for timeout, which aborts the request the body belongs to.
+type stallGuard struct {
+	body    io.Reader
+	timer   *time.Timer
+	timeout time.Duration
+	stalled atomic.Bool
+}
+
+func guardStall(body io.Reader, timeout time.Duration, cancel context.CancelFunc) *stallGuard {
+	g := &stallGuard{body: body, timeout: timeout}
+	g.timer = time.AfterFunc(timeout, func() {
+		g.stalled.Store(true)
+		cancel()
+	})
+	return g
+}
+
+func (g *stallGuard) Read(p []byte) (int, error) {
+	n, err := g.body.Read(p)
+	if n > 0 {
+		g.timer.Reset(g.timeout)
+	}
+	if err != nil && g.stalled.Load() {
+		err = fmt.Errorf("%w: no data received for %s", errDownloadStalled, g.timeout)
+	}
+	return n, err
+}
+
+func (g *stallGuard) stop() {
+	g.timer.Stop()
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+type RepositorySummary struct {
+	Name        string                     `json:"repo_name"`
+	Description string                     `json:"short_description"`
+	PullCount   int                        `json:"pull_count"`
+	StarCount   int                        `json:"star_count"`
+	IsOfficial  bool                       `json:"is_official"`
+	LastUpdated string                     `json:"last_updated,omitempty"`
+	Extra       map[string]json.RawMessage `json:"-"`
+}
+
+type SearchResult struct {
+	NumResults int                        `json:"count"`
+	Next       string                     `json:"next"`
+	Results    []RepositorySummary        `json:"results"`
+	Extra      map[string]json.RawMessage `json:"-"`
+}
+
+type RepositoryInfo struct {
+	Namespace   string `json:"namespace"`
+	Name        string `json:"name"`
+	PullCount   int64  `json:"pull_count"`
+	StarCount   int    `json:"star_count"`
+	IsPrivate   bool   `json:"is_private"`
+	LastUpdated string `json:"last_updated"`
+}
+
+type TagSummary struct {
+	Name        string                     `json:"name"`
+	LastUpdated string                     `json:"last_updated"`
+	FullSize    int64                      `json:"full_size,omitempty"`
+	Images      []TagImage                 `json:"images,omitempty"`
+	Extra       map[string]json.RawMessage `json:"-"`
+}
+
+// TagImage is one platform image behind a tag.
+type TagImage struct {
+	Architecture string `json:"architecture"`
+	Variant      string `json:"variant,omitempty"`
+	OS           string `json:"os"`
+	Size         int64  `json:"size"`
+	Digest       string `json:"digest,omitempty"`
+}
+
+// pushed returns the date part of LastUpdated.
+func (t TagSummary) pushed() string {
+	if len(t.LastUpdated) >= len("2006-01-02") {
+		return t.LastUpdated[:len("2006-01-02")]
+	}
+	return t.LastUpdated
+}
+
+// tagDetails summarizes when a tag was pushed, how big it is and for which
+// platforms, leaving out what Hub did not report.
+func tagDetails(t TagSummary) string {
+	var details []string
+	if pushed := t.pushed(); pushed != "" {
+		details = append(details, "pushed "+pushed)
+	}
+	if t.FullSize > 0 {
+		details = append(details, formatBytes(t.FullSize))
+	}
+	if architectures := t.architectures(); architectures != "" {
+		details = append(details, architectures)
+	}
+	return strings.Join(details, ", ")
+}
+
+// architectures lists the platforms of the tag, such as amd64, arm64/v8.
+// Windows images keep their OS in front.
+func (t TagSummary) architectures() string {
+	var platforms []string
+	for _, image := range t.Images {
+		platform := image.Architecture
+		if image.Variant != "" {
+			platform += "/" + image.Variant
+		}
+		if image.OS != "" && image.OS != "linux" {
+			platform = image.OS + "/" + platform
+		}
+		if platform != "" && !slices.Contains(platforms, platform) {
+			platforms = append(platforms, platform)
+		}
+	}
+	return strings.Join(platforms, ", ")
+}
+
+type TagsResult struct {
+	Count    int                        `json:"count"`
+	Next     string                     `json:"next"`
+	Previous string                     `json:"previous"`
+	Results  []TagSummary               `json:"results"`
+	Extra    map[string]json.RawMessage `json:"-"`
+	// Fetched is how many tags were read before --tag-filter applied.
+	Fetched int `json:"-"`
+}
+
+func hubRepoPath(repo string) string {
+	if !strings.Contains(repo, "/") {
+		return "library/" + repo
+	}
+	return repo
+}
+
+func getRepositoryInfo(repo string) (*RepositoryInfo, error) {
+	infoURL := fmt.Sprintf("https://hub.docker.com/v2/repositories/%s/", hubRepoPath(repo))
+	data, err := hubGet(infoURL, "get repository info")
+	if err != nil {
+		return nil, err
+	}
+
+	var info RepositoryInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, err
+	}
+
+	return &info, nil
+}
+
+func fetchPaginatedResults(url string) ([]RepositorySummary, error) {
+	var allResults []RepositorySummary
+
+	count := 0
+	for {
+		if count >= 100 {
+			break
+		}
+
+		data, err := hubGet(url, "search repositories")
+		if err != nil {
+			return nil, err
+		}
+
+		var searchResult SearchResult
+		if err := json.Unmarshal(data, &searchResult); err != nil {
+			return nil, err
+		}
+
+		if searchResult.NumResults > 0 && len(searchResult.Results) == 0 && len(allResults) == 0 {
+			return nil, newRegistryError(ErrHubSchema, "search repositories", "")
+		}
+
+		allResults = append(allResults, searchResult.Results...)
+		count += len(searchResult.Results)
+
+		if searchResult.Next == "" {
+			break
+		}
+
+		url = searchResult.Next
+	}
+
+	if len(allResults) > 100 {
+		allResults = allResults[:100]
+	}
+
+	return allResults, nil
+}
+
+// repoFilter narrows search results to interesting targets.
+type repoFilter struct {
+	officialOnly bool
+	minStars     int
+	minPulls     int
+}
+
+// searchFilter is set with --official-only, --min-stars and --min-pulls.
+var searchFilter repoFilter
+
+func (f repoFilter) matches(repo RepositorySummary) bool {
+	return (!f.officialOnly || repo.IsOfficial) && repo.StarCount >= f.minStars && repo.PullCount >= f.minPulls
+}
+
+// searchRepositories asks Hub for official images only when that filter is
+// set, since its search API supports it; star and pull thresholds are
+// applied to the results.
+func searchRepositories(term string) ([]RepositorySummary, error) {
+	params := url.Values{}
+	params.Add("query", term)
+	if searchFilter.officialOnly {
+		params.Add("is_official", "true")
+	}
+	found, err := fetchPaginatedResults(fmt.Sprintf("%s?%s", "https://hub.docker.com/v2/search/repositories", params.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	var results []RepositorySummary
+	for _, result := range found {
+		if searchFilter.matches(result) {
+			results = append(results, result)
+		}
+	}
+	if len(results) < len(found) {
+		logger.Debug("search results filtered", "term", term, "kept", len(results), "found", len(found))
+	}
+	rememberRepos(results)
+	return results, nil
+}
+
+// listNamespaceRepositories enumerates every public repository of a user or
+// organization, which search only finds when their names match the term.
+// term, when set, keeps repositories whose name or description contains it.
+func listNamespaceRepositories(namespace, term string) ([]RepositorySummary, error) {
+	next := fmt.Sprintf("https://hub.docker.com/v2/repositories/%s/?page_size=100", url.PathEscape(namespace))
+	var results []RepositorySummary
+	for next != "" {
+		data, err := hubGet(next, "list repositories")
+		if err != nil {
+			return nil, err
+		}
+		var page SearchResult
+		if err := json.Unmarshal(data, &page); err != nil {
+			return nil, err
+		}
+		if page.NumResults > 0 && len(page.Results) == 0 && len(results) == 0 {
+			return nil, newRegistryError(ErrHubSchema, "list repositories", "")
+		}
+		for _, result := range page.Results {
+			if !strings.Contains(result.Name, "/") {
+				result.Name = namespace + "/" + result.Name
+			}
+			text := strings.ToLower(result.Name + " " + result.Description)
+			if searchFilter.matches(result) && strings.Contains(text, strings.ToLower(term)) {
+				results = append(results, result)
+			}
+		}
+		next = page.Next
+	}
+	rememberRepos(results)
+	return results, nil
+}
+
+// rememberRepos keeps listed repositories for shell completion.
+func rememberRepos(results []RepositorySummary) {
+	names := make([]string, len(results))
+	for i, result := range results {
+		names[i] = result.Name
+	}
+	if err := recordRecentRepos(names); err != nil {
+		logger.Debug("could not record recent repositories", "error", err)
+	}
+}
+
+// tagPageSize and maxTags, set with --tag-page-size and --max-tags, control
+// how tag listings are paged and where they stop. maxTags 0 lists every tag.
+// Hub serves at most maxTagPageSize tags per page.
+var (
+	tagPageSize = 100
+	maxTags     = 1000
+)
+
+const maxTagPageSize = 100
+
+// fetchTags lists up to maxTags tags that pass --tag-filter. Count stays
+// the repository's real total, so callers can tell when the list was capped.
+func fetchTags(repo string) (*TagsResult, error) {
+	listing, err := fetchTagPages(repo, "", maxTags)
+	if err != nil {
+		return nil, err
+	}
+	if listing.Fetched < listing.Count {
+		logger.Info("tag list capped", "repo", repo, "fetched", listing.Fetched, "total", listing.Count, "hint", "raise --max-tags to see more")
+	}
+	return listing, nil
+}
+
+// summary counts the listed tags for people: how many there are and, when
+// --tag-filter dropped some, how many were fetched to find them.
+func (t *TagsResult) summary() string {
+	if tagFilter == nil {
+		return fmt.Sprintf("%d of %d tags", len(t.Results), t.Count)
+	}
+	return fmt.Sprintf("%d tags matching --tag-filter, %d of %d fetched", len(t.Results), t.Fetched, t.Count)
+}
+
+// tagFilter, set with --tag-filter, limits which tags are listed and scanned.
+var tagFilter *regexp.Regexp
+
+func filterTags(tags []TagSummary) []TagSummary {
+	if tagFilter == nil {
+		return tags
+	}
+	var kept []TagSummary
+	for _, tag := range tags {
+		if tagFilter.MatchString(tag.Name) {
+			kept = append(kept, tag)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// hubCacheTTL, set with --cache-ttl, is how long Hub search, tag and
+// repository responses are reused from disk. 0 disables the cache.
+var hubCacheTTL = 10 * time.Minute
+
+func hubCachePath(url string) string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(dir, "dockerspy", "hub", hex.EncodeToString(sum[:])+".json")
+}
+
+// hubGet returns the body of a Hub API response, from the on-disk cache when
+// a copy younger than hubCacheTTL exists. Only successful responses are kept.
+// With Docker Hub credentials configured the request is authenticated, which
+// raises the rate limit, and cached apart from anonymous responses since it
+// may include private repositories.
+func hubGet(url, op string) ([]byte, error) {
+	jwt := hubTokenOrAnonymous()
+	key := url
+	if jwt != "" {
+		username, _ := hubCredentials()
+		key = username + "@" + url
+	}
+	path := hubCachePath(key)
+	if hubCacheTTL > 0 {
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) < hubCacheTTL {
+			if data, err := os.ReadFile(path); err == nil {
+				logger.Debug("using cached Hub response", "url", url, "age", time.Since(info.ModTime()).Round(time.Second))
+				return data, nil
+			}
+		}
+	}
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if jwt != "" {
+		req.Header.Set("Authorization", "Bearer "+jwt)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := classifyResponse(resp, op); err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if hubCacheTTL > 0 {
+		if err := writeHubCache(path, data); err != nil {
+			logger.Debug("could not cache Hub response", "url", url, "error", err)
+		}
+	}
+	return data, nil
+}
+
+// writeHubCache replaces the entry atomically, so parallel scans never read
+// a half-written response.
+func writeHubCache(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Docker Hub has changed the shape of its search and tag payloads more than
+// once. The types below accept every shape seen so far, keep any field they
+// do not know in Extra, and leave it to the callers to notice a payload that
+// claims results but yields none.
+
+// flexInt decodes counts sent as numbers, numeric strings or abbreviated
+// strings such as "10M+".
+type flexInt int64
+
+func (n *flexInt) UnmarshalJSON(data []byte) error {
+	var number int64
+	if err := json.Unmarshal(data, &number); err == nil {
+		*n = flexInt(number)
+		return nil
+	}
+
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return err
+	}
+	text = strings.TrimSuffix(strings.TrimSpace(strings.ReplaceAll(text, ",", "")), "+")
+	multiplier := 1.0
+	if text != "" {
+		switch strings.ToUpper(text[len(text)-1:]) {
+		case "K":
+			multiplier = 1e3
+		case "M":
+			multiplier = 1e6
+		case "B":
+			multiplier = 1e9
+		}
+		if multiplier != 1 {
+			text = text[:len(text)-1]
+		}
+	}
+	value, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return fmt.Errorf("unrecognized count %q", string(data))
+	}
+	*n = flexInt(value * multiplier)
+	return nil
+}
+
+type rawObject map[string]json.RawMessage
+
+// schemaWarned remembers the fields already reported as undecodable, so a
+// page of results logs each once.
+var schemaWarned sync.Map
+
+// take decodes the first of keys that is present into v and removes it from
+// the object, so what is left over are the unknown fields. A known field
+// that fails to decode is logged as schema drift and treated as missing.
+func (o rawObject) take(v interface{}, keys ...string) bool {
+	found := false
+	for _, key := range keys {
+		raw, ok := o[key]
+		if !ok {
+			continue
+		}
+		delete(o, key)
+		if found || string(raw) == "null" {
+			continue
+		}
+		if err := json.Unmarshal(raw, v); err != nil {
+			if _, seen := schemaWarned.LoadOrStore(key, true); !seen {
+				logger.Warn("Docker Hub field has an unexpected shape", "field", key, "error", err, "hint", errorHints[ErrHubSchema])
+			}
+			continue
+		}
+		found = true
+	}
+	return found
+}
+
+func (o rawObject) extra() map[string]json.RawMessage {
+	if len(o) == 0 {
+		return nil
+	}
+	return o
+}
+
+func (r *RepositorySummary) UnmarshalJSON(data []byte) error {
+	var obj rawObject
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return err
+	}
+
+	var namespace, badge string
+	var pulls, stars flexInt
+	obj.take(&r.Name, "repo_name", "name", "slug")
+	obj.take(&namespace, "namespace", "repo_owner")
+	obj.take(&r.Description, "short_description", "description")
+	obj.take(&pulls, "pull_count", "pulls")
+	obj.take(&stars, "star_count", "stars")
+	obj.take(&badge, "badge")
+	obj.take(&r.LastUpdated, "last_updated", "updated_at")
+	if !obj.take(&r.IsOfficial, "is_official") {
+		r.IsOfficial = badge == "official"
+	}
+	if namespace != "" && namespace != "library" && !strings.Contains(r.Name, "/") {
+		r.Name = namespace + "/" + r.Name
+	}
+	r.PullCount = int(pulls)
+	r.StarCount = int(stars)
+	r.Extra = obj.extra()
+	return nil
+}
+
+func (s *SearchResult) UnmarshalJSON(data []byte) error {
+	var obj rawObject
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return err
+	}
+
+	var count flexInt
+	obj.take(&count, "count", "total", "num_results")
+	obj.take(&s.Next, "next")
+	obj.take(&s.Results, "results", "summaries")
+	s.NumResults = int(count)
+	s.Extra = obj.extra()
+	return nil
+}
+
+func (t *TagSummary) UnmarshalJSON(data []byte) error {
+	var obj rawObject
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return err
+	}
+
+	obj.take(&t.Name, "name", "tag")
+	obj.take(&t.LastUpdated, "last_updated", "tag_last_pushed")
+	var size flexInt
+	obj.take(&size, "full_size", "size")
+	obj.take(&t.Images, "images")
+	t.FullSize = int64(size)
+	t.Extra = obj.extra()
+	return nil
+}
+
+func (t *TagsResult) UnmarshalJSON(data []byte) error {
+	var obj rawObject
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return err
+	}
+
+	var count flexInt
+	obj.take(&count, "count", "total")
+	obj.take(&t.Next, "next")
+	obj.take(&t.Previous, "previous")
+	obj.take(&t.Results, "results", "tags")
+	t.Count = int(count)
+	t.Extra = obj.extra()
+	return nil
+}
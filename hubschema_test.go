@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDecodeSearchPayloads(t *testing.T) {
+	tests := []struct {
+		file     string
+		count    int
+		next     string
+		names    []string
+		pulls    []int
+		stars    []int
+		official []bool
+	}{
+		{
+			file:     "search_v2.json",
+			count:    2,
+			next:     "https://hub.docker.com/v2/search/repositories?query=nginx&page=2",
+			names:    []string{"nginx", "bitnami/nginx"},
+			pulls:    []int{1000000000, 500000000},
+			stars:    []int{19876, 190},
+			official: []bool{true, false},
+		},
+		{
+			file:     "search_content_api.json",
+			count:    2,
+			names:    []string{"nginx", "bitnami/nginx"},
+			pulls:    []int{1000000000, 500000000},
+			stars:    []int{19800, 190},
+			official: []bool{true, false},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			var result SearchResult
+			decodeFixture(t, tt.file, &result)
+			if result.NumResults != tt.count || result.Next != tt.next {
+				t.Errorf("count, next = %d, %q; want %d, %q", result.NumResults, result.Next, tt.count, tt.next)
+			}
+			if len(result.Results) != len(tt.names) {
+				t.Fatalf("got %d results, want %d", len(result.Results), len(tt.names))
+			}
+			for i, repo := range result.Results {
+				if repo.Name != tt.names[i] || repo.PullCount != tt.pulls[i] || repo.StarCount != tt.stars[i] || repo.IsOfficial != tt.official[i] {
+					t.Errorf("result %d = %s pulls=%d stars=%d official=%t; want %s pulls=%d stars=%d official=%t",
+						i, repo.Name, repo.PullCount, repo.StarCount, repo.IsOfficial, tt.names[i], tt.pulls[i], tt.stars[i], tt.official[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeTagPayloads(t *testing.T) {
+	tests := []struct {
+		file   string
+		count  int
+		names  []string
+		sizes  []int64
+		pushed bool
+		images int
+	}{
+		{file: "tags_v2.json", count: 3, names: []string{"3.20", "latest"}, sizes: []int64{3623807, 3623807}, pushed: true, images: 2},
+		{file: "tags_renamed.json", count: 3, names: []string{"3.20", "latest"}, sizes: []int64{3623807, 3623807}, pushed: true},
+		{file: "tags_drifted.json", count: 0, names: []string{"latest"}, sizes: []int64{0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			var result TagsResult
+			decodeFixture(t, tt.file, &result)
+			if result.Count != tt.count {
+				t.Errorf("count = %d, want %d", result.Count, tt.count)
+			}
+			if len(result.Results) != len(tt.names) {
+				t.Fatalf("got %d tags, want %d", len(result.Results), len(tt.names))
+			}
+			for i, tag := range result.Results {
+				if tag.Name != tt.names[i] || tag.FullSize != tt.sizes[i] || (tag.LastUpdated != "") != tt.pushed {
+					t.Errorf("tag %d = %s size=%d pushed=%q; want %s size=%d", i, tag.Name, tag.FullSize, tag.LastUpdated, tt.names[i], tt.sizes[i])
+				}
+			}
+			if got := len(result.Results[0].Images); got != tt.images {
+				t.Errorf("first tag has %d images, want %d", got, tt.images)
+			}
+		})
+	}
+}
+
+func TestFlexIntRejectsUnknownCounts(t *testing.T) {
+	for _, input := range []string{`"lots"`, `"1.2.3M"`, `true`} {
+		var n flexInt
+		if err := json.Unmarshal([]byte(input), &n); err == nil {
+			t.Errorf("%s decoded to %d without an error", input, n)
+		}
+	}
+}
+
+func decodeFixture(t *testing.T, name string, v interface{}) {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "hub", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const maxConfigSize = 8 << 20
+
+type ImageConfig struct {
+	Architecture string          `json:"architecture"`
+	OS           string          `json:"os"`
+	Author       string          `json:"author,omitempty"`
+	Created      string          `json:"created,omitempty"`
+	Config       ContainerConfig `json:"config"`
+	History      []HistoryEntry  `json:"history,omitempty"`
+}
+
+// HistoryEntry describes the build step behind each layer, including steps
+// that produced no layer.
+type HistoryEntry struct {
+	Created    string `json:"created,omitempty"`
+	CreatedBy  string `json:"created_by,omitempty"`
+	Author     string `json:"author,omitempty"`
+	Comment    string `json:"comment,omitempty"`
+	EmptyLayer bool   `json:"empty_layer,omitempty"`
+}
+
+type ContainerConfig struct {
+	Labels       map[string]string   `json:"Labels"`
+	Env          []string            `json:"Env"`
+	Entrypoint   []string            `json:"Entrypoint"`
+	Cmd          []string            `json:"Cmd"`
+	User         string              `json:"User"`
+	WorkingDir   string              `json:"WorkingDir"`
+	ExposedPorts map[string]struct{} `json:"ExposedPorts"`
+}
+
+// ImageConfigSummary is the part of the image config kept in the report.
+// Labels are reported on their own.
+type ImageConfigSummary struct {
+	Created      string         `json:"created,omitempty"`
+	Author       string         `json:"author,omitempty"`
+	User         string         `json:"user,omitempty"`
+	WorkingDir   string         `json:"workingDir,omitempty"`
+	Entrypoint   []string       `json:"entrypoint,omitempty"`
+	Cmd          []string       `json:"cmd,omitempty"`
+	ExposedPorts []string       `json:"exposedPorts,omitempty"`
+	Env          []string       `json:"env,omitempty"`
+	History      []HistoryEntry `json:"history,omitempty"`
+	Dockerfile   string         `json:"dockerfile,omitempty"`
+}
+
+var attributionLabels = []string{
+	"maintainer",
+	"org.opencontainers.image.authors",
+	"org.opencontainers.image.vendor",
+	"org.opencontainers.image.source",
+	"org.opencontainers.image.url",
+	"org.opencontainers.image.revision",
+	"org.opencontainers.image.created",
+	"org.label-schema.vcs-url",
+	"org.label-schema.vcs-ref",
+	"org.label-schema.build-date",
+	"vcs-ref",
+	"vcs-url",
+	"build-date",
+}
+
+// getImageConfig fetches the config blob of manifest, or returns the config
+// rebuilt from the history of a schema 1 manifest.
+func getImageConfig(ctx context.Context, s *registrySession, manifest *Manifest) (*ImageConfig, error) {
+	if manifest.legacyConfig != nil {
+		return manifest.legacyConfig, nil
+	}
+	desc := manifest.Config
+	if desc.Digest == "" {
+		return nil, fmt.Errorf("manifest has no config descriptor")
+	}
+
+	blob, err := fetchBlob(ctx, s, desc.Digest, maxConfigSize)
+	if err != nil {
+		return nil, err
+	}
+
+	var config ImageConfig
+	if err := json.Unmarshal(blob, &config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+func (c *ImageConfig) labels() map[string]string {
+	labels := make(map[string]string, len(c.Config.Labels)+1)
+	for key, value := range c.Config.Labels {
+		labels[key] = value
+	}
+	if c.Author != "" {
+		if _, ok := labels["maintainer"]; !ok {
+			labels["maintainer"] = c.Author
+		}
+	}
+	return labels
+}
+
+func scanLabels(labels map[string]string, patterns map[string]Matcher) map[string]map[string][]string {
+	matches := make(map[string]map[string][]string)
+	for key, value := range labels {
+		if found := checkPatterns(value, patterns); len(found) > 0 {
+			matches["label:"+key] = found
+		}
+	}
+	return matches
+}
+
+func (c *ImageConfig) summary() *ImageConfigSummary {
+	summary := &ImageConfigSummary{
+		Created:    c.Created,
+		Author:     c.Author,
+		User:       c.Config.User,
+		WorkingDir: c.Config.WorkingDir,
+		Entrypoint: c.Config.Entrypoint,
+		Cmd:        c.Config.Cmd,
+		Env:        c.Config.Env,
+		History:    c.History,
+	}
+	for port := range c.Config.ExposedPorts {
+		summary.ExposedPorts = append(summary.ExposedPorts, port)
+	}
+	sort.Strings(summary.ExposedPorts)
+	summary.Dockerfile = reconstructDockerfile(c.History)
+	return summary
+}
+
+// reconstructDockerfile turns the created_by lines of the history back into
+// instructions. The result is approximate: the steps of the base image are
+// included, COPY and ADD only name the digest of what was copied, and the
+// build args the classic builder recorded with each RUN are kept as a
+// comment above it.
+func reconstructDockerfile(history []HistoryEntry) string {
+	var b strings.Builder
+	b.WriteString("# Reconstructed from the image history, base image steps included\n")
+	b.WriteString("FROM scratch\n")
+	steps := 0
+	for _, entry := range history {
+		instruction, args := dockerfileInstruction(entry.CreatedBy)
+		if instruction == "" {
+			continue
+		}
+		if args != "" {
+			fmt.Fprintf(&b, "# build args: %s\n", args)
+		}
+		b.WriteString(instruction + "\n")
+		steps++
+	}
+	if steps == 0 {
+		return ""
+	}
+	return b.String()
+}
+
+// dockerfileInstruction parses one created_by line, as written by the
+// classic builder ("/bin/sh -c #(nop)  CMD [...]", "|2 A=1 B=2 /bin/sh -c
+// make") or BuildKit ("RUN |2 A=1 B=2 /bin/sh -c make # buildkit").
+func dockerfileInstruction(createdBy string) (instruction, buildArgs string) {
+	line := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(createdBy), "# buildkit"))
+	if line == "" {
+		return "", ""
+	}
+	line, run := strings.CutPrefix(line, "RUN ")
+	if rest, ok := strings.CutPrefix(line, "|"); ok {
+		count, after, _ := strings.Cut(rest, " ")
+		var n int
+		fmt.Sscanf(count, "%d", &n)
+		fields := strings.SplitN(after, " ", n+1)
+		if n > 0 && len(fields) == n+1 {
+			buildArgs = strings.Join(fields[:n], " ")
+			line = fields[n]
+		}
+	}
+	if rest, ok := strings.CutPrefix(line, "/bin/sh -c "); ok {
+		if nop, ok := strings.CutPrefix(rest, "#(nop) "); ok && !run {
+			return strings.TrimSpace(nop), buildArgs
+		}
+		return "RUN " + rest, buildArgs
+	}
+	if run {
+		return "RUN " + line, buildArgs
+	}
+	return line, buildArgs
+}
+
+// scanImageConfig runs the patterns over the environment, entrypoint,
+// command and build history of the config. A build step repeating a value
+// already found in the environment, such as the ENV step that set it, is
+// not reported twice.
+func scanImageConfig(c *ImageConfig, patterns map[string]Matcher) map[string]map[string][]string {
+	matches := scanEnv(c.Config.Env, patterns)
+	seen := make(map[string]bool)
+	for _, rules := range matches {
+		for _, values := range rules {
+			for _, value := range values {
+				seen[value] = true
+			}
+		}
+	}
+	sources := map[string]string{
+		"config:entrypoint": strings.Join(c.Config.Entrypoint, " "),
+		"config:cmd":        strings.Join(c.Config.Cmd, " "),
+	}
+	for i, entry := range c.History {
+		sources[fmt.Sprintf("history:%d", i)] = entry.CreatedBy
+	}
+	for source, content := range sources {
+		found := checkPatterns(content, patterns)
+		for rule, values := range found {
+			var fresh []string
+			for _, value := range values {
+				if !seen[value] {
+					fresh = append(fresh, value)
+				}
+			}
+			if len(fresh) == 0 {
+				delete(found, rule)
+			} else {
+				found[rule] = fresh
+			}
+		}
+		if len(found) > 0 {
+			matches[source] = found
+		}
+	}
+	return matches
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// IndexedImage lists every file of a scanned image so later queries can be
+// answered without downloading the image again.
+type IndexedImage struct {
+	Image   string        `json:"image"`
+	Scanned time.Time     `json:"scanned"`
+	Layers  []string      `json:"layers,omitempty"`
+	Files   []IndexedFile `json:"files"`
+}
+
+type IndexedFile struct {
+	Path   string `json:"path"`
+	Layer  string `json:"layer"`
+	Size   int64  `json:"size"`
+	Digest string `json:"digest,omitempty"`
+}
+
+type indexQuery struct {
+	Name         string
+	PathContains string
+	Digest       string
+}
+
+func (q indexQuery) matches(file IndexedFile) bool {
+	if q.Name != "" && filepath.Base(file.Path) != q.Name {
+		return false
+	}
+	if q.PathContains != "" && !strings.Contains(file.Path, q.PathContains) {
+		return false
+	}
+	if q.Digest != "" && file.Digest != q.Digest {
+		return false
+	}
+	return true
+}
+
+func defaultIndexDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "dockerspy", "index")
+}
+
+func indexFiles(layer Descriptor, metadata map[string]FileMeta) []IndexedFile {
+	files := make([]IndexedFile, 0, len(metadata))
+	for rel, meta := range metadata {
+		files = append(files, IndexedFile{
+			Path:   "/" + filepath.ToSlash(rel),
+			Layer:  layer.Digest,
+			Size:   meta.Size,
+			Digest: meta.Digest,
+		})
+	}
+	return files
+}
+
+func writeIndex(dir string, image *IndexedImage) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(image)
+	if err != nil {
+		return err
+	}
+	name := strings.NewReplacer("/", "_", ":", "_").Replace(image.Image) + ".json"
+	return os.WriteFile(filepath.Join(dir, name), data, 0o600)
+}
+
+// searchIndex calls found for every indexed file matching q.
+func searchIndex(dir string, q indexQuery, found func(image string, file IndexedFile)) error {
+	return forEachIndexedImage(dir, func(image IndexedImage) {
+		for _, file := range image.Files {
+			if q.matches(file) {
+				found(image.Image, file)
+			}
+		}
+	})
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// Journal events, in the order a scan produces them.
+const (
+	journalScanStarted   = "scan_started"
+	journalLayerFetched  = "layer_fetched"
+	journalLayerFailed   = "layer_failed"
+	journalFinding       = "finding"
+	journalScanFailed    = "scan_failed"
+	journalScanCompleted = "scan_completed"
+)
+
+// journalEvent is one line of the journal. Findings record the rule and how
+// often it matched, never the matched secret itself.
+type journalEvent struct {
+	Time     time.Time `json:"time"`
+	Event    string    `json:"event"`
+	Image    string    `json:"image"`
+	Layer    string    `json:"layer,omitempty"`
+	Size     int64     `json:"size,omitempty"`
+	Cached   bool      `json:"cached,omitempty"`
+	Path     string    `json:"path,omitempty"`
+	Rule     string    `json:"rule,omitempty"`
+	Severity string    `json:"severity,omitempty"`
+	Count    int       `json:"count,omitempty"`
+	Findings int       `json:"findings,omitempty"`
+	Partial  string    `json:"partial,omitempty"`
+	Duration string    `json:"duration,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// scanJournal appends one JSON object per event to a file set with
+// --journal, so what a long sweep did can be followed and replayed later.
+// A nil journal records nothing.
+type scanJournal struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func openJournal(path string) (*scanJournal, error) {
+	if path == "" {
+		return nil, nil
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &scanJournal{file: file}, nil
+}
+
+func (j *scanJournal) record(event journalEvent) {
+	if j == nil {
+		return
+	}
+	event.Time = time.Now().UTC()
+	line, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, err := j.file.Write(append(line, '\n')); err != nil {
+		logger.Warn("could not write to scan journal", "path", j.file.Name(), "error", err)
+	}
+}
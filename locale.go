@@ -0,0 +1,97 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Message catalogs for text reports, one file per language named by its
+// code. A locales/<code>.json in a config directory takes precedence over
+// the built-in one, so teams can adjust or add translations.
+//
+//go:embed src/locales/*.json
+var embeddedLocales embed.FS
+
+// messageCatalog maps English messages, without surrounding whitespace, to
+// their translation. Format verbs stay in the order of the original.
+type messageCatalog struct {
+	Language string            `json:"language"`
+	Messages map[string]string `json:"messages"`
+}
+
+// reportMessages is the catalog selected with --locale; nil means English.
+var reportMessages map[string]string
+
+// tr translates message, keeping its leading and trailing whitespace, or
+// returns it unchanged when the catalog has no entry.
+func tr(message string) string {
+	core := strings.TrimSpace(message)
+	translated, ok := reportMessages[core]
+	if !ok || core == "" {
+		return message
+	}
+	start := strings.Index(message, core)
+	return message[:start] + translated + message[start+len(core):]
+}
+
+// localeCandidates turns a locale such as pt_BR.UTF-8 into the catalog
+// names to try: pt-br, then pt.
+func localeCandidates(locale string) []string {
+	locale = strings.ToLower(locale)
+	if i := strings.IndexAny(locale, ".@"); i >= 0 {
+		locale = locale[:i]
+	}
+	locale = strings.ReplaceAll(locale, "_", "-")
+	candidates := []string{locale}
+	if language, _, ok := strings.Cut(locale, "-"); ok {
+		candidates = append(candidates, language)
+	}
+	return candidates
+}
+
+// setReportLocale loads the catalog for locale. English, C and POSIX need
+// none.
+func setReportLocale(locale string) error {
+	reportMessages = nil
+	if locale == "" || locale == "C" || locale == "POSIX" {
+		return nil
+	}
+	for _, name := range localeCandidates(locale) {
+		if name == "en" {
+			return nil
+		}
+		data, err := readLocale(name)
+		if err != nil {
+			continue
+		}
+		var catalog messageCatalog
+		if err := json.Unmarshal(data, &catalog); err != nil {
+			return fmt.Errorf("invalid message catalog for %s: %v", name, err)
+		}
+		reportMessages = catalog.Messages
+		return nil
+	}
+	return fmt.Errorf("no message catalog for locale %q; available: en, %s", locale, strings.Join(availableLocales(), ", "))
+}
+
+func readLocale(name string) ([]byte, error) {
+	if path := resolveConfigFile("", filepath.Join("locales", name+".json")); path != "" {
+		return os.ReadFile(path)
+	}
+	return embeddedLocales.ReadFile("src/locales/" + name + ".json")
+}
+
+func availableLocales() []string {
+	entries, _ := embeddedLocales.ReadDir("src/locales")
+	var names []string
+	for _, entry := range entries {
+		names = append(names, strings.TrimSuffix(entry.Name(), ".json"))
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/fatih/color"
+	"github.com/mattn/go-isatty"
+)
+
+var (
+	logLevel = new(slog.LevelVar)
+	logger   = slog.New(newConsoleHandler(os.Stderr, logLevel))
+	jsonLogs bool
+)
+
+func setupLogging(verbose, quiet, noColor bool, format string) error {
+	if noColor || os.Getenv("NO_COLOR") != "" {
+		color.NoColor = true
+	}
+
+	switch {
+	case verbose && quiet:
+		return fmt.Errorf("--verbose and --quiet cannot be used together")
+	case verbose:
+		logLevel.Set(slog.LevelDebug)
+	case quiet:
+		logLevel.Set(slog.LevelWarn)
+	default:
+		logLevel.Set(slog.LevelInfo)
+	}
+
+	switch format {
+	case "", "text":
+		handler := newConsoleHandler(os.Stderr, logLevel)
+		handler.color = !color.NoColor && isatty.IsTerminal(os.Stderr.Fd())
+		logger = slog.New(handler)
+		progress.enabled = isatty.IsTerminal(os.Stderr.Fd()) && !quiet
+	case "json":
+		jsonLogs = true
+		logger = slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: logLevel}))
+	default:
+		return fmt.Errorf("unknown log format: %s", format)
+	}
+	return nil
+}
+
+// consoleHandler keeps the colored, human-oriented look of the original
+// terminal output while still going through leveled logging.
+type consoleHandler struct {
+	mu    *sync.Mutex
+	out   io.Writer
+	level slog.Leveler
+	color bool
+	attrs []slog.Attr
+}
+
+func newConsoleHandler(out io.Writer, level slog.Leveler) *consoleHandler {
+	return &consoleHandler{mu: &sync.Mutex{}, out: out, level: level, color: !color.NoColor}
+}
+
+func (h *consoleHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *consoleHandler) Handle(_ context.Context, record slog.Record) error {
+	var paint func(a ...interface{}) string
+	switch {
+	case record.Level >= slog.LevelError:
+		paint = color.New(color.FgRed).SprintFunc()
+	case record.Level >= slog.LevelWarn:
+		paint = color.New(color.FgYellow).SprintFunc()
+	case record.Level >= slog.LevelInfo:
+		paint = color.New(color.FgCyan).SprintFunc()
+	default:
+		paint = color.New(color.Faint).SprintFunc()
+	}
+
+	var buf strings.Builder
+	if h.color {
+		buf.WriteString(paint(record.Message))
+	} else {
+		buf.WriteString(record.Message)
+	}
+	writeAttr := func(attr slog.Attr) bool {
+		fmt.Fprintf(&buf, " %s=%v", attr.Key, attr.Value)
+		return true
+	}
+	for _, attr := range h.attrs {
+		writeAttr(attr)
+	}
+	record.Attrs(writeAttr)
+	buf.WriteString("\n")
+
+	return progress.around(func() error {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		_, err := io.WriteString(h.out, buf.String())
+		return err
+	})
+}
+
+func (h *consoleHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := *h
+	clone.attrs = append(append([]slog.Attr(nil), h.attrs...), attrs...)
+	return &clone
+}
+
+func (h *consoleHandler) WithGroup(string) slog.Handler {
+	return h
+}
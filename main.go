@@ -3,177 +3,91 @@ package main
 import (
 	"archive/tar"
 	"bufio"
+	"bytes"
 	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/fatih/color"
+	"github.com/klauspost/compress/zstd"
+	"github.com/mattn/go-isatty"
 	"io"
-	"net/http"
-	"net/url"
+	"log/slog"
 	"os"
+	"os/signal"
 	"path/filepath"
-	"regexp"
 	"strconv"
 	"strings"
+	"syscall"
 )
 
 type IgnoreExtensions struct {
 	Extensions []string `json:"extensions"`
 }
 
-type SearchResult struct {
-	NumResults int    `json:"count"`
-	Next       string `json:"next"`
-	Results    []struct {
-		Name        string `json:"repo_name"`
-		Description string `json:"short_description"`
-		PullCount   int    `json:"pull_count"`
-		StarCount   int    `json:"star_count"`
-		IsOfficial  bool   `json:"is_official"`
-	} `json:"results"`
-}
-
-type TagsResult struct {
-	Count    int    `json:"count"`
-	Next     string `json:"next"`
-	Previous string `json:"previous"`
-	Results  []struct {
-		Name string `json:"name"`
-	} `json:"results"`
-}
-
-const (
-	dockerHubAPI = "https://registry-1.docker.io/v2/"
-)
-
-type TokenResponse struct {
-	Token string `json:"token"`
-}
-
-type Manifest struct {
-	Config    Descriptor   `json:"config"`
-	Layers    []Descriptor `json:"layers"`
-	MediaType string       `json:"mediaType"`
-}
-
-type Descriptor struct {
-	MediaType string `json:"mediaType"`
-	Size      int64  `json:"size"`
-	Digest    string `json:"digest"`
-}
-
-func getDockerHubToken(repo string) (string, error) {
-	authURL := fmt.Sprintf("https://auth.docker.io/token?service=registry.docker.io&scope=repository:%s:pull", repo)
-	resp, err := http.Get(authURL)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("failed to authenticate: %s", resp.Status)
-	}
-
-	var tokenResponse TokenResponse
-	if err := json.NewDecoder(resp.Body).Decode(&tokenResponse); err != nil {
-		return "", err
-	}
-
-	return tokenResponse.Token, nil
-}
-
-func getManifest(repo, tag, token string) (*Manifest, error) {
-	client := &http.Client{}
-	url := fmt.Sprintf("%s%s/manifests/%s", dockerHubAPI, repo, tag)
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Authorization", "Bearer "+token)
-	req.Header.Set("Accept", "application/vnd.docker.distribution.manifest.v2+json")
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to get manifest: %s", resp.Status)
-	}
-
-	var manifest Manifest
-	if err := json.NewDecoder(resp.Body).Decode(&manifest); err != nil {
-		return nil, err
-	}
-
-	return &manifest, nil
-}
-
-func downloadLayer(repo, token, digest, outputPath string, size int64) error {
-	client := &http.Client{}
-	url := fmt.Sprintf("%s%s/blobs/%s", dockerHubAPI, repo, digest)
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return err
-	}
-	req.Header.Set("Authorization", "Bearer "+token)
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to download layer: %s", resp.Status)
-	}
-
-	file, err := os.Create(outputPath)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
-	progressWriter := &ProgressWriter{Writer: file, Total: size}
-	_, err = io.Copy(progressWriter, resp.Body)
-	return err
-}
-
 type ProgressWriter struct {
 	Writer     io.Writer
 	Total      int64
 	Downloaded int64
+	Bar        *layerBar
 }
 
 func (pw *ProgressWriter) Write(p []byte) (int, error) {
 	n, err := pw.Writer.Write(p)
 	pw.Downloaded += int64(n)
-	pw.printProgress()
+	if pw.Bar != nil && progress.enabled {
+		progress.advance(pw.Bar, int64(n))
+	} else {
+		pw.printProgress()
+	}
 	return n, err
 }
 
 func (pw *ProgressWriter) printProgress() {
+	if jsonLogs || !logger.Enabled(context.Background(), slog.LevelInfo) {
+		return
+	}
+	if pw.Total <= 0 {
+		// Schema 1 manifests do not give layer sizes.
+		fmt.Fprintf(os.Stderr, "\rDownloading... %s", formatBytes(pw.Downloaded))
+		return
+	}
 	percent := float64(pw.Downloaded) / float64(pw.Total) * 100
-	fmt.Printf("\rDownloading... %.2f%% complete", percent)
+	fmt.Fprintf(os.Stderr, "\rDownloading... %.2f%% complete", percent)
+	if pw.Downloaded >= pw.Total {
+		fmt.Fprintln(os.Stderr)
+	}
 }
 
-func loadRegexPatterns(filename string) (map[string]*regexp.Regexp, error) {
-	file, err := os.Open(filename)
-	if err != nil {
-		return nil, err
+// loadRegexPatterns reads filename, or only the built-in patterns when it is
+// empty. With extend, the file adds to and overrides the built-in patterns
+// instead of replacing them.
+func loadRegexPatterns(filename string, extend bool) (map[string]Matcher, error) {
+	patterns := make(map[string]string)
+	if filename == "" || extend {
+		if err := json.Unmarshal(builtinRules("regex_patterns.json", embeddedRegexPatterns), &patterns); err != nil {
+			return nil, err
+		}
 	}
-	defer file.Close()
+	if filename != "" {
+		file, err := os.Open(filename)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
 
-	var patterns map[string]string
-	decoder := json.NewDecoder(file)
-	if err := decoder.Decode(&patterns); err != nil {
-		return nil, err
+		decoder := json.NewDecoder(file)
+		if err := decoder.Decode(&patterns); err != nil {
+			return nil, err
+		}
 	}
 
-	regexPatterns := make(map[string]*regexp.Regexp)
+	regexPatterns := make(map[string]Matcher)
 	for name, pattern := range patterns {
-		re, err := regexp.Compile(pattern)
+		re, err := compileMatcher(name, pattern)
 		if err != nil {
 			return nil, fmt.Errorf("failed to compile regex %s: %v", name, err)
 		}
@@ -183,7 +97,7 @@ func loadRegexPatterns(filename string) (map[string]*regexp.Regexp, error) {
 	return regexPatterns, nil
 }
 
-func checkPatterns(content string, patterns map[string]*regexp.Regexp) map[string][]string {
+func checkPatterns(content string, patterns map[string]Matcher) map[string][]string {
 	matches := make(map[string][]string)
 	for name, re := range patterns {
 		foundMatches := re.FindAllString(content, -1)
@@ -194,53 +108,155 @@ func checkPatterns(content string, patterns map[string]*regexp.Regexp) map[strin
 	return matches
 }
 
-func extractTarGz(tarGzPath, outputDir string) error {
-	file, err := os.Open(tarGzPath)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
-	gzr, err := gzip.NewReader(file)
+// extractTarGz unpacks regular files and directories under outputDir and
+// returns their tar metadata. With writeFiles false nothing is written and
+// only the metadata is collected.
+func extractTarGz(ctx context.Context, tarGzPath, outputDir string, writeFiles bool) (map[string]FileMeta, error) {
+	layer, err := openLayer(tarGzPath)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer gzr.Close()
+	defer layer.Close()
 
-	tarReader := tar.NewReader(gzr)
+	metadata := make(map[string]FileMeta)
+	tarReader := tar.NewReader(layer)
 	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
 		header, err := tarReader.Next()
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		target := filepath.Join(outputDir, header.Name)
+		if !writeFiles {
+			if header.Typeflag == tar.TypeReg {
+				metadata[target] = fileMetaFromHeader(header)
+			}
+			continue
+		}
 		switch header.Typeflag {
 		case tar.TypeDir:
 			if err := os.MkdirAll(target, os.ModePerm); err != nil {
-				return err
+				return nil, err
 			}
 		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+				return nil, err
+			}
 			outFile, err := os.Create(target)
 			if err != nil {
-				return err
+				return nil, err
 			}
-			if _, err := io.Copy(outFile, tarReader); err != nil {
+			hasher := sha256.New()
+			if _, err := io.Copy(io.MultiWriter(outFile, hasher), tarReader); err != nil {
 				outFile.Close()
-				return err
+				return nil, err
 			}
 			outFile.Close()
+			meta := fileMetaFromHeader(header)
+			meta.Digest = "sha256:" + hex.EncodeToString(hasher.Sum(nil))
+			metadata[target] = meta
 		default:
 			//fmt.Printf("Unable to untar type: %c in file %s", header.Typeflag, header.Name)
 		}
 	}
+	return metadata, nil
+}
+
+// extractArtifact places a non-tar layer under outputDir as a single file,
+// named by its org.opencontainers.image.title annotation when it has one.
+func extractArtifact(blobPath string, layer Descriptor, outputDir string, writeFiles bool) (map[string]FileMeta, error) {
+	name := filepath.Base(filepath.Clean("/" + layer.Annotations["org.opencontainers.image.title"]))
+	if name == "/" || name == "." {
+		_, name, _ = strings.Cut(layer.Digest, ":")
+	}
+	target := filepath.Join(outputDir, name)
+
+	info, err := os.Stat(blobPath)
+	if err != nil {
+		return nil, err
+	}
+	meta := FileMeta{ModTime: info.ModTime().UTC(), Mode: os.FileMode(0o644).String(), Size: info.Size(), Digest: layer.Digest}
+	if writeFiles {
+		data, err := os.ReadFile(blobPath)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(outputDir, os.ModePerm); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(target, data, 0o644); err != nil {
+			return nil, err
+		}
+	}
+	return map[string]FileMeta{target: meta}, nil
+}
+
+type layerReader struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (l *layerReader) Close() error {
+	for i := len(l.closers) - 1; i >= 0; i-- {
+		l.closers[i].Close()
+	}
 	return nil
 }
 
-func loadIgnoreExtensions(filename string) ([]string, error) {
+// openLayer returns the uncompressed tar stream of a downloaded layer blob,
+// which may be gzip or zstd compressed. Layers of images saved with docker
+// save may be plain tarballs.
+func openLayer(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	buffered := bufio.NewReader(file)
+	magic, _ := buffered.Peek(4)
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		gzr, err := gzip.NewReader(buffered)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		return &layerReader{Reader: gzr, closers: []io.Closer{file, gzr}}, nil
+	case bytes.HasPrefix(magic, zstdMagic):
+		zr, err := zstd.NewReader(buffered)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		return &layerReader{Reader: zr, closers: []io.Closer{file, zr.IOReadCloser()}}, nil
+	}
+	return &layerReader{Reader: buffered, closers: []io.Closer{file}}, nil
+}
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+func loadIgnoreExtensions(filename string, extend bool) ([]string, error) {
+	var extensions []string
+	if filename == "" || extend {
+		var builtin IgnoreExtensions
+		if err := json.Unmarshal(builtinRules("ignore_extensions.json", embeddedIgnoreExtensions), &builtin); err != nil {
+			return nil, err
+		}
+		extensions = builtin.Extensions
+	}
+	if filename == "" {
+		return extensions, nil
+	}
+
 	file, err := os.Open(filename)
 	if err != nil {
 		return nil, err
@@ -253,7 +269,12 @@ func loadIgnoreExtensions(filename string) ([]string, error) {
 		return nil, err
 	}
 
-	return ignoreExtensions.Extensions, nil
+	for _, ext := range ignoreExtensions.Extensions {
+		if !containsString(extensions, ext) {
+			extensions = append(extensions, ext)
+		}
+	}
+	return extensions, nil
 }
 
 func shouldSkipFile(filename string, ignoreExtensions []string) bool {
@@ -265,6 +286,18 @@ func shouldSkipFile(filename string, ignoreExtensions []string) bool {
 	return false
 }
 
+// shouldSkipDir reports whether rel, a path inside a layer, is under one of
+// the ignore entries that start with "/", such as /usr/share/doc.
+func shouldSkipDir(rel string, ignoreExtensions []string) bool {
+	slashed := "/" + strings.TrimPrefix(filepath.ToSlash(rel), "/")
+	for _, entry := range ignoreExtensions {
+		if strings.HasPrefix(entry, "/") && strings.HasPrefix(slashed, strings.TrimSuffix(entry, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
 func removeDir(dir string) error {
 	if _, err := os.Stat(dir); os.IsNotExist(err) {
 		return nil
@@ -279,92 +312,244 @@ func printBanner() {
 ┃╰╯┈┈┈┈┈┈╰╮╰╮╭╯┈   DOCKERSPY by Alisson Moretto (UndeadSec)
 ┣━━╯┈┈┈┈┈┈╰━╯┃┈┈         AUTOMATED OSINT ON DOCKER HUB     
 ╰━━━━━━━━━━━━╯┈┈`
-	fmt.Println(color.New(color.FgGreen).Sprint(banner))
+	fmt.Fprintln(humanOutput(), color.New(color.FgGreen).Sprint(banner))
 }
 
-func fetchPaginatedResults(url string) ([]struct {
-	Name        string `json:"repo_name"`
-	Description string `json:"short_description"`
-	PullCount   int    `json:"pull_count"`
-	StarCount   int    `json:"star_count"`
-	IsOfficial  bool   `json:"is_official"`
-}, error) {
-	var allResults []struct {
-		Name        string `json:"repo_name"`
-		Description string `json:"short_description"`
-		PullCount   int    `json:"pull_count"`
-		StarCount   int    `json:"star_count"`
-		IsOfficial  bool   `json:"is_official"`
-	}
-
-	count := 0
-	for {
-		if count >= 100 {
-			break
-		}
+func printError(msg string, err error) {
+	if hint := errorHint(err); hint != "" {
+		logger.Error(msg, "error", err, "hint", hint)
+		return
+	}
+	logger.Error(msg, "error", err)
+}
 
-		resp, err := http.Get(url)
-		if err != nil {
-			return nil, err
-		}
-		defer resp.Body.Close()
+var (
+	info      = color.New(color.FgCyan).SprintFunc()
+	warning   = color.New(color.FgYellow).SprintFunc()
+	highlight = color.New(color.FgHiMagenta, color.Bold).SprintFunc()
+)
 
-		if resp.StatusCode != http.StatusOK {
-			return nil, fmt.Errorf("API response error: %s", resp.Status)
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		// Restore the default handlers so a second signal exits at once.
+		stop()
+		logger.Warn("interrupted, saving partial results (press Ctrl+C again to quit immediately)")
+	}()
+
+	if err := newRootCmd().ExecuteContext(ctx); err != nil {
+		printError("error", err)
+		var exitErr *exitError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.code)
 		}
+		os.Exit(1)
+	}
+}
 
-		var searchResult SearchResult
-		if err := json.NewDecoder(resp.Body).Decode(&searchResult); err != nil {
-			return nil, err
-		}
+// loadConfiguredPatterns loads the regex patterns the settings point to.
+func loadConfiguredPatterns() (map[string]Matcher, error) {
+	regexPath := resolveConfigFile(settings.RegexPatterns, "regex_patterns.json")
+	if regexPath == "" {
+		logger.Debug("no regex_patterns.json found, using built-in patterns")
+	}
+	regexPatterns, err := loadRegexPatterns(regexPath, settings.ExtendDefaults)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load regex patterns: %v", err)
+	}
+	return regexPatterns, nil
+}
 
-		allResults = append(allResults, searchResult.Results...)
-		count += len(searchResult.Results)
+func loadScanConfig(opts *scanOptions) (*scanConfig, error) {
+	regexPatterns, err := loadConfiguredPatterns()
+	if err != nil {
+		return nil, err
+	}
 
-		if searchResult.Next == "" {
-			break
-		}
+	ignorePath := resolveConfigFile(settings.IgnoreExtensions, "ignore_extensions.json")
+	if ignorePath == "" {
+		logger.Debug("no ignore_extensions.json found, using built-in list")
+	}
+	ignoreExtensions, err := loadIgnoreExtensions(ignorePath, settings.ExtendDefaults)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load ignore extensions: %v", err)
+	}
 
-		url = searchResult.Next
+	sinks, err := loadSinks(resolveConfigFile(settings.Sinks, "sinks.json"), opts.output)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load output sinks: %v", err)
 	}
 
-	if len(allResults) > 100 {
-		allResults = allResults[:100]
+	profile, ok := scanProfiles[opts.profile]
+	if !ok {
+		return nil, fmt.Errorf("unknown profile %q (available: %s)", opts.profile, profileNames())
 	}
 
-	return allResults, nil
-}
+	if opts.allTags && opts.latest > 0 {
+		return nil, fmt.Errorf("--all-tags and --latest cannot be used together")
+	}
 
-func main() {
-	printBanner()
+	var indexDir string
+	if opts.index {
+		indexDir = defaultIndexDir()
+	}
+
+	if opts.signKey != "" {
+		reportSigner, err = loadSigner(opts.signKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load signing key: %v", err)
+		}
+	}
 
-	err := removeDir("docker_image")
+	allowlistPath := dispositionFile(settings.Allowlist, "allowlist.json")
+	allowlist, err := loadAllowlist(allowlistPath)
 	if err != nil {
-		fmt.Println("\nError removing docker_image directory:", err)
-		return
+		return nil, fmt.Errorf("failed to load allowlist %s: %v", allowlistPath, err)
+	}
+
+	var placeholders placeholderSet
+	if !opts.keepPlaceholders {
+		placeholdersPath := resolveConfigFile(settings.Placeholders, "placeholders.json")
+		placeholders, err = loadPlaceholders(placeholdersPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load placeholders %s: %v", placeholdersPath, err)
+		}
 	}
 
-	regexPatterns, err := loadRegexPatterns("/etc/dockerspy/configs/regex_patterns.json")
+	hubJWT := hubTokenOrAnonymous()
+
+	failOn := opts.failOn
+	if failOn == "none" {
+		failOn = ""
+	}
+	if failOn != "" && severityRank[failOn] == 0 {
+		return nil, fmt.Errorf("unknown severity for --fail-on: %s", opts.failOn)
+	}
+
+	blobs, err := newBlobManager(defaultBlobCacheDir(), defaultBlobCacheSize)
 	if err != nil {
-		fmt.Println("\nError loading regex patterns:", err)
-		return
+		return nil, fmt.Errorf("failed to prepare blob cache: %v", err)
 	}
 
-	ignoreExtensions, err := loadIgnoreExtensions("/etc/dockerspy/configs/ignore_extensions.json")
+	journal, err := openJournal(opts.journal)
 	if err != nil {
-		fmt.Println("\nError loading ignore extensions:", err)
+		return nil, fmt.Errorf("failed to open scan journal: %v", err)
+	}
+
+	return &scanConfig{
+		regexPatterns:    regexPatterns,
+		ignoreExtensions: ignoreExtensions,
+		sinks:            sinks,
+		blobs:            blobs,
+		outputDir:        opts.workdir,
+		maxDuration:      opts.maxDuration,
+		hubJWT:           hubJWT,
+		failOn:           failOn,
+		dryRun:           opts.dryRun,
+		allowlist:        allowlist,
+		placeholders:     placeholders,
+		profile:          profile,
+		layers:           newLayerCache(),
+		allTags:          opts.allTags,
+		indexDir:         indexDir,
+		latest:           opts.latest,
+		keepArtifacts:    opts.keepArtifacts,
+		scanNested:       opts.scanNested || profile.NestedImages,
+		rulesDigest:      rulesDigest(regexPatterns, ignoreExtensions),
+		journal:          journal,
+	}, nil
+}
+
+func runInteractive(ctx context.Context, cfg *scanConfig) {
+	if !isatty.IsTerminal(os.Stdin.Fd()) || !isatty.IsTerminal(os.Stdout.Fd()) {
+		runPrompt(ctx, cfg)
 		return
 	}
 
+	for {
+		repo, tags, ok, err := browseImages()
+		if err != nil {
+			printError("error running the interface", err)
+			return
+		}
+		if !ok {
+			return
+		}
+
+		if cfg.dryRun {
+			for _, tag := range tags {
+				if err := previewImage(ctx, parseImageReference(repo+":"+tag)); err != nil {
+					printError("error reading manifest", err)
+				}
+			}
+			continue
+		}
+
+		var reports []*Report
+		for _, tag := range tags {
+			if ctx.Err() != nil {
+				break
+			}
+			for _, target := range platformTargets(ctx, cfg, parseImageReference(repo+":"+tag)) {
+				report, err := scanImage(ctx, cfg, target)
+				if err != nil {
+					printError("error scanning image", err)
+					continue
+				}
+				reports = append(reports, report)
+			}
+		}
+		if len(reports) > 0 {
+			emitReports(ctx, cfg, reports)
+			if jsonOutput {
+				printJSONOrLog(reports)
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if len(reports) == 0 {
+			continue
+		}
+
+		findings := 0
+		for _, report := range reports {
+			findings += report.findingCount()
+		}
+		if findings > 0 && confirm(fmt.Sprintf("Review %d finding(s) now? [y/N] ", findings)) {
+			if err := reviewFindings(reports); err != nil {
+				printError("error saving review", err)
+			}
+		}
+	}
+}
+
+// printJSONOrLog writes v to stdout as in the non-interactive commands; the
+// interactive flows log a failed write and keep going.
+func printJSONOrLog(v interface{}) {
+	if err := printJSON(v); err != nil {
+		printError("error writing JSON output", err)
+	}
+}
+
+func confirm(question string) bool {
+	fmt.Fprint(humanOutput(), info(question))
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// runPrompt is the line-based flow used when stdin or stdout is not a
+// terminal, so piped answers keep working.
+func runPrompt(ctx context.Context, cfg *scanConfig) {
 	scanner := bufio.NewScanner(os.Stdin)
-	info := color.New(color.FgCyan).SprintFunc()
-	warning := color.New(color.FgYellow).SprintFunc()
-	errorColor := color.New(color.FgRed).SprintFunc()
-	success := color.New(color.FgGreen).SprintFunc()
-	highlight := color.New(color.FgHiMagenta, color.Bold).SprintFunc()
+	// With --json, stdout carries only the JSON documents.
+	out := humanOutput()
 
 	for {
-		fmt.Print(info("\nEnter search term (or 'exit' to quit): "))
+		fmt.Fprint(out, info("\nEnter search term (or 'exit' to quit): "))
 		scanner.Scan()
 		searchTerm := scanner.Text()
 
@@ -372,23 +557,21 @@ func main() {
 			break
 		}
 
-		dockerHubURL := "https://hub.docker.com/v2/search/repositories"
-		params := url.Values{}
-		params.Add("query", searchTerm)
-
-		searchURL := fmt.Sprintf("%s?%s", dockerHubURL, params.Encode())
-		results, err := fetchPaginatedResults(searchURL)
+		results, err := searchRepositories(searchTerm)
 		if err != nil {
-			fmt.Println(errorColor("\nError fetching search results:"), err)
+			printError("error fetching search results", err)
 			continue
 		}
 
-		fmt.Printf(info("\nFound %d results for '%s':"), len(results), searchTerm)
+		fmt.Fprintf(out, info("\nFound %d results for '%s':"), len(results), searchTerm)
 		for i, result := range results {
-			fmt.Printf("\n%s - Name: %s\nDescription: %s\nStars: %d\nOfficial: %t", highlight(i+1), result.Name, result.Description, result.StarCount, result.IsOfficial)
+			fmt.Fprintf(out, "\n%s - Name: %s\nDescription: %s\nStars: %d\nOfficial: %t", highlight(i+1), result.Name, result.Description, result.StarCount, result.IsOfficial)
+		}
+		if jsonOutput {
+			printJSONOrLog(results)
 		}
 
-		fmt.Print(info("\nChoose a number or enter the full name to view repository tags (or 'cancel' to search again): "))
+		fmt.Fprint(out, info("\nChoose a number or enter the full name to view repository tags (or 'cancel' to search again): "))
 		scanner.Scan()
 		choice := scanner.Text()
 
@@ -404,26 +587,24 @@ func main() {
 			selectedRepo = choice
 		}
 
-		tagsURL := fmt.Sprintf("https://hub.docker.com/v2/repositories/%s/tags", selectedRepo)
-		resp, err := http.Get(tagsURL)
+		tagsResult, err := fetchTags(selectedRepo)
 		if err != nil {
-			fmt.Println(errorColor("\nError fetching tags:"), err)
-			continue
-		}
-		defer resp.Body.Close()
-
-		var tagsResult TagsResult
-		if err := json.NewDecoder(resp.Body).Decode(&tagsResult); err != nil {
-			fmt.Println(errorColor("\nError decoding JSON response:"), err)
+			printError("error fetching tags", err)
 			continue
 		}
 
-		fmt.Printf(info("Available tags for repository '%s':"), selectedRepo)
+		fmt.Fprintf(out, info("Available tags for repository '%s' (%s):"), selectedRepo, tagsResult.summary())
 		for i, tag := range tagsResult.Results {
-			fmt.Printf("\n%s - %s", highlight(i+1), tag.Name)
+			fmt.Fprintf(out, "\n%s - %s", highlight(i+1), tag.Name)
+			if details := tagDetails(tag); details != "" {
+				fmt.Fprintf(out, " (%s)", details)
+			}
+		}
+		if jsonOutput {
+			printJSONOrLog(tagsResult.Results)
 		}
 
-		fmt.Print(info("\nChoose a number to download the tag (or 'cancel' to search again): "))
+		fmt.Fprint(out, info("\nChoose a number to download the tag (or 'cancel' to search again): "))
 		scanner.Scan()
 		tagChoice := scanner.Text()
 
@@ -433,105 +614,36 @@ func main() {
 
 		tagChoiceNum, err := strconv.Atoi(tagChoice)
 		if err != nil || tagChoiceNum < 1 || tagChoiceNum > len(tagsResult.Results) {
-			fmt.Println(warning("\nInvalid choice. Please try again."))
+			fmt.Fprintln(out, warning("\nInvalid choice. Please try again."))
 			continue
 		}
 
 		tag := tagsResult.Results[tagChoiceNum-1].Name
 
-		repo := selectedRepo
-		outputDir := "./docker_image"
-
-		token, err := getDockerHubToken(repo)
-		if err != nil {
-			fmt.Println("\nError getting token:", err)
-			return
-		}
-
-		manifest, err := getManifest(repo, tag, token)
-		if err != nil {
-			fmt.Println("\nError getting manifest:", err)
-			return
-		}
-
-		os.MkdirAll(outputDir, os.ModePerm)
-
-		var envContent string
-		matchesResult := make(map[string]map[string][]string)
-
-		for _, layer := range manifest.Layers {
-			digestParts := strings.Split(layer.Digest, ":")
-			if len(digestParts) != 2 {
-				fmt.Println("\nInvalid digest format:", layer.Digest)
-				continue
-			}
-			outputPath := filepath.Join(outputDir, digestParts[1]+".tar.gz")
-			fmt.Println("\nDownloading layer:", layer.Digest)
-			if err := downloadLayer(repo, token, layer.Digest, outputPath, layer.Size); err != nil {
-				fmt.Println("\nError downloading layer:", err)
-				return
+		if cfg.dryRun {
+			if err := previewImage(ctx, parseImageReference(selectedRepo+":"+tag)); err != nil {
+				printError("error reading manifest", err)
 			}
+			continue
+		}
 
-			extractedDir := filepath.Join(outputDir, digestParts[1])
-			fmt.Println("\nExtracting layer:", outputPath)
-			if err := extractTarGz(outputPath, extractedDir); err != nil {
-				fmt.Println("\nError extracting layer:", err)
+		var reports []*Report
+		for _, target := range platformTargets(ctx, cfg, parseImageReference(selectedRepo+":"+tag)) {
+			report, err := scanImage(ctx, cfg, target)
+			if err != nil {
+				printError("error scanning image", err)
 				continue
 			}
-
-			filepath.Walk(extractedDir, func(path string, info os.FileInfo, err error) error {
-				if err != nil {
-					return err
-				}
-				if !info.IsDir() && !shouldSkipFile(path, ignoreExtensions) {
-					content, err := os.ReadFile(path)
-					if err != nil {
-						fmt.Println("\nError reading file:", err)
-						return nil
-					}
-					if filepath.Base(path) == ".env" {
-						fmt.Println(success("\nFound .env file:"))
-						envContent = string(content)
-						fmt.Println(envContent)
-					}
-					matches := checkPatterns(string(content), regexPatterns)
-					if len(matches) > 0 {
-						fmt.Println(success("\nMatches found in file:"), path)
-						matchesResult[path] = matches
-						for pattern, matchedStrings := range matches {
-							fmt.Printf("  Pattern: %s\n", pattern)
-							for _, match := range matchedStrings {
-								fmt.Printf("    %s\n", match)
-							}
-						}
-					}
-				}
-				return nil
-			})
+			reports = append(reports, report)
 		}
-
-		fmt.Println(success("\nImage downloaded and extracted successfully\n"))
-
-		resultData := map[string]interface{}{
-			"selectedRepo": selectedRepo,
-			"selectedTag":  tag,
-			"envContent":   envContent,
-			"matches":      matchesResult,
-		}
-
-		jsonFile, err := os.Create("results.json")
-		if err != nil {
-			fmt.Println(errorColor("\nError creating JSON file:"), err)
-			return
+		if len(reports) > 0 {
+			emitReports(ctx, cfg, reports)
+			if jsonOutput {
+				printJSONOrLog(reports)
+			}
 		}
-		defer jsonFile.Close()
-
-		encoder := json.NewEncoder(jsonFile)
-		if err := encoder.Encode(resultData); err != nil {
-			fmt.Println(errorColor("\nError encoding JSON:"), err)
+		if ctx.Err() != nil {
 			return
 		}
-
-		fmt.Println(success("Results saved to results.json"))
 	}
 }
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"regexp"
+	"time"
+
+	"github.com/dlclark/regexp2"
+)
+
+const pcreMatchTimeout = 2 * time.Second
+
+type Matcher interface {
+	FindAllString(content string, n int) []string
+	Engine() string
+	String() string
+}
+
+type re2Matcher struct {
+	*regexp.Regexp
+}
+
+func (m re2Matcher) Engine() string { return "re2" }
+
+// pcreMatcher backs rules that need lookarounds or backreferences. Those
+// features allow catastrophic backtracking, so every search is time-limited.
+type pcreMatcher struct {
+	name string
+	re   *regexp2.Regexp
+}
+
+func (m *pcreMatcher) Engine() string { return "pcre" }
+
+func (m *pcreMatcher) String() string { return m.re.String() }
+
+func (m *pcreMatcher) FindAllString(content string, n int) []string {
+	var found []string
+	match, err := m.re.FindStringMatch(content)
+	for match != nil && (n < 0 || len(found) < n) {
+		found = append(found, match.String())
+		match, err = m.re.FindNextMatch(match)
+	}
+	if err != nil {
+		logger.Warn("pattern timed out, results may be incomplete", "pattern", m.name, "error", err)
+	}
+	return found
+}
+
+func compileMatcher(name, pattern string) (Matcher, error) {
+	re, err := regexp.Compile(pattern)
+	if err == nil {
+		return re2Matcher{re}, nil
+	}
+
+	pcre, pcreErr := regexp2.Compile(pattern, regexp2.None)
+	if pcreErr != nil {
+		return nil, err
+	}
+	pcre.MatchTimeout = pcreMatchTimeout
+	logger.Debug("pattern not supported by RE2, using PCRE-compatible engine", "pattern", name)
+	return &pcreMatcher{name: name, re: pcre}, nil
+}
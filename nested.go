@@ -0,0 +1,239 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// NestedArtifact is an image or VM disk found inside a layer. Build images
+// often embed other images, which carry secrets of their own.
+type NestedArtifact struct {
+	Path    string `json:"path"`
+	Layer   string `json:"layer,omitempty"`
+	Kind    string `json:"kind"`
+	Size    int64  `json:"size"`
+	Scanned bool   `json:"scanned"`
+}
+
+const (
+	artifactDockerArchive = "docker-archive"
+	artifactOCILayout     = "oci-layout"
+	artifactOVA           = "ova"
+	artifactQCOW2         = "qcow2"
+	artifactVMDK          = "vmdk"
+	artifactVHD           = "vhd"
+	artifactVHDX          = "vhdx"
+
+	// maxNestedDepth bounds recursion into images embedded in images.
+	maxNestedDepth = 3
+)
+
+type nestedDepthKey struct{}
+
+func withNestedDepth(ctx context.Context, depth int) context.Context {
+	return context.WithValue(ctx, nestedDepthKey{}, depth)
+}
+
+func nestedDepthFrom(ctx context.Context) int {
+	depth, _ := ctx.Value(nestedDepthKey{}).(int)
+	return depth
+}
+
+// detectArtifact recognizes docker save tarballs, OCI layouts (as tarballs
+// or as an oci-layout file on disk) and VM disk images by their content.
+func detectArtifact(name string, content []byte) string {
+	switch {
+	case filepath.Base(name) == "oci-layout" && bytes.Contains(content, []byte("imageLayoutVersion")):
+		return artifactOCILayout
+	case bytes.HasPrefix(content, []byte("QFI\xfb")):
+		return artifactQCOW2
+	case bytes.HasPrefix(content, []byte("KDMV")), bytes.HasPrefix(content, []byte("# Disk DescriptorFile")):
+		return artifactVMDK
+	case bytes.HasPrefix(content, []byte("vhdxfile")):
+		return artifactVHDX
+	case bytes.HasPrefix(content, []byte("conectix")), len(content) >= 512 && bytes.HasPrefix(content[len(content)-512:], []byte("conectix")):
+		return artifactVHD
+	}
+
+	var r io.Reader = bytes.NewReader(content)
+	switch {
+	case bytes.HasPrefix(content, gzipMagic):
+		gzr, err := gzip.NewReader(r)
+		if err != nil {
+			return ""
+		}
+		r = gzr
+	case bytes.HasPrefix(content, zstdMagic):
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return ""
+		}
+		defer zr.Close()
+		r = zr
+	}
+	return tarArtifactKind(r)
+}
+
+// tarArtifactKind tells image archives and OVA bundles apart from ordinary
+// tarballs by the files at their root.
+func tarArtifactKind(r io.Reader) string {
+	tarReader := tar.NewReader(r)
+	hasManifest, hasLayout := false, false
+	for {
+		header, err := tarReader.Next()
+		if err != nil {
+			break
+		}
+		switch name := cleanEntryName(header.Name); {
+		case name == "oci-layout":
+			hasLayout = true
+		case name == "manifest.json":
+			hasManifest = true
+		case strings.HasSuffix(name, ".ovf") && !strings.Contains(name, "/"):
+			return artifactOVA
+		}
+	}
+	switch {
+	case hasLayout:
+		return artifactOCILayout
+	case hasManifest:
+		return artifactDockerArchive
+	}
+	return ""
+}
+
+// scanNested unpacks the image archive at path under workDir, or reads the
+// OCI layout directory it names, and scans every layer of the embedded
+// image. Matches are keyed by path relative to the embedded layer root.
+func scanNested(ctx context.Context, cfg *scanConfig, path, kind, workDir string) (*layerResult, error) {
+	root := path
+	if filepath.Base(path) == "oci-layout" {
+		root = filepath.Dir(path)
+	} else {
+		root = filepath.Join(workDir, "image")
+		if _, err := extractTarGz(ctx, path, root, true); err != nil {
+			return nil, err
+		}
+	}
+
+	layers, err := nestedLayers(root)
+	if err != nil {
+		return nil, err
+	}
+
+	merged := &layerResult{
+		metadata:  make(map[string]FileMeta),
+		matches:   make(map[string]map[string][]string),
+		encodings: make(map[string]string),
+	}
+	ctx = withNestedDepth(ctx, nestedDepthFrom(ctx)+1)
+	for i, layer := range layers {
+		result, err := scanLayer(ctx, cfg, layer, Descriptor{}, filepath.Join(workDir, "layers", strconv.Itoa(i)), nil)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			logger.Warn("could not scan embedded layer", "layer", layer, "error", err)
+			continue
+		}
+		for rel, matches := range result.matches {
+			if merged.matches[rel] == nil {
+				merged.matches[rel] = make(map[string][]string)
+			}
+			for rule, found := range matches {
+				merged.matches[rel][rule] = append(merged.matches[rel][rule], found...)
+			}
+			if encoding, ok := result.encodings[rel]; ok {
+				merged.encodings[rel] = encoding
+			}
+		}
+		merged.nested = append(merged.nested, result.nested...)
+		if result.partial {
+			merged.partial = true
+			break
+		}
+	}
+	return merged, nil
+}
+
+// nestedLayers lists the layer blobs of an unpacked docker save archive or
+// OCI layout, base layer first.
+func nestedLayers(root string) ([]string, error) {
+	var layers []string
+	seen := make(map[string]bool)
+	add := func(name string) {
+		name = cleanEntryName(name)
+		if name != "" && !seen[name] {
+			seen[name] = true
+			layers = append(layers, filepath.Join(root, filepath.FromSlash(name)))
+		}
+	}
+
+	if data, err := os.ReadFile(filepath.Join(root, "manifest.json")); err == nil {
+		var images []struct {
+			Layers []string `json:"Layers"`
+		}
+		if err := json.Unmarshal(data, &images); err != nil {
+			return nil, err
+		}
+		for _, image := range images {
+			for _, layer := range image.Layers {
+				add(layer)
+			}
+		}
+		return layers, nil
+	}
+
+	data, err := os.ReadFile(filepath.Join(root, "index.json"))
+	if err != nil {
+		return nil, err
+	}
+	var walk func(data []byte, depth int) error
+	walk = func(data []byte, depth int) error {
+		var doc struct {
+			Manifests []IndexEntry `json:"manifests"`
+			Layers    []Descriptor `json:"layers"`
+		}
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return err
+		}
+		for _, layer := range doc.Layers {
+			add(layoutBlob(layer.Digest))
+		}
+		if depth > maxNestedDepth {
+			return nil
+		}
+		for _, entry := range doc.Manifests {
+			child, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(layoutBlob(entry.Digest))))
+			if err != nil {
+				logger.Debug("manifest missing from OCI layout", "digest", entry.Digest, "error", err)
+				continue
+			}
+			if err := walk(child, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return layers, walk(data, 0)
+}
+
+// layoutBlob is where an OCI layout stores the blob with digest.
+func layoutBlob(digest string) string {
+	algorithm, hex, err := splitDigest(digest)
+	if err != nil {
+		return ""
+	}
+	return path.Join("blobs", algorithm, hex)
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+)
+
+// jsonOutput is set by --json: results go to stdout as JSON and everything
+// meant for people goes to stderr.
+var jsonOutput bool
+
+func printJSON(v interface{}) error {
+	return json.NewEncoder(os.Stdout).Encode(v)
+}
+
+// humanOutput is where text for people is printed.
+func humanOutput() io.Writer {
+	if jsonOutput {
+		return os.Stderr
+	}
+	return os.Stdout
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"os"
+	"strings"
+)
+
+// Well-known example secrets from vendor documentation and templates, and
+// generic stand-in values such as changeme. A placeholders.json in the
+// config search path adds to the built-in lists.
+//
+//go:embed src/configs/placeholders.json
+var embeddedPlaceholders []byte
+
+type PlaceholderList struct {
+	Placeholders []string `json:"placeholders"`
+	Values       []string `json:"values"`
+}
+
+// placeholderSet holds the lowercased lists. Examples are distinctive
+// enough to be found anywhere in a match; values only count when they are
+// the whole value, so changeme does not hide a real password that happens
+// to contain it.
+type placeholderSet struct {
+	examples []string
+	values   []string
+}
+
+// dispositionPlaceholder marks a match dropped because it is a documented
+// example value rather than a real secret.
+const dispositionPlaceholder = "placeholder"
+
+// SuppressedMatch is a match left out of the findings, with why.
+type SuppressedMatch struct {
+	Path        string `json:"path"`
+	Rule        string `json:"rule"`
+	Match       string `json:"match"`
+	Disposition string `json:"disposition"`
+}
+
+// loadPlaceholders returns the built-in placeholders and those in filename,
+// lowercased for matching.
+func loadPlaceholders(filename string) (placeholderSet, error) {
+	var builtin PlaceholderList
+	if err := json.Unmarshal(builtinRules("placeholders.json", embeddedPlaceholders), &builtin); err != nil {
+		return placeholderSet{}, err
+	}
+	examples, values := builtin.Placeholders, builtin.Values
+	if filename != "" {
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			return placeholderSet{}, err
+		}
+		var user PlaceholderList
+		if err := json.Unmarshal(data, &user); err != nil {
+			return placeholderSet{}, err
+		}
+		examples = append(examples, user.Placeholders...)
+		values = append(values, user.Values...)
+	}
+	set := placeholderSet{examples: make([]string, len(examples)), values: make([]string, len(values))}
+	for i, placeholder := range examples {
+		set.examples[i] = strings.ToLower(placeholder)
+	}
+	for i, placeholder := range values {
+		set.values[i] = strings.ToLower(placeholder)
+	}
+	return set, nil
+}
+
+// assignedValue is what follows the last = or : in match, without quotes
+// and spaces, or the whole match when it has neither.
+func assignedValue(match string) string {
+	if i := strings.LastIndexAny(match, "=:"); i >= 0 {
+		match = match[i+1:]
+	}
+	return strings.Trim(match, " \t\"'`,;")
+}
+
+// isPlaceholder reports whether match contains one of the example secrets,
+// or its value, as in password=changeme, is one of the generic values.
+func isPlaceholder(match string, placeholders placeholderSet) bool {
+	match = strings.ToLower(match)
+	for _, placeholder := range placeholders.examples {
+		if placeholder != "" && strings.Contains(match, placeholder) {
+			return true
+		}
+	}
+	value := assignedValue(match)
+	for _, placeholder := range placeholders.values {
+		if placeholder != "" && (value == placeholder || strings.TrimSpace(match) == placeholder) {
+			return true
+		}
+	}
+	return false
+}
+
+// suppressPlaceholders removes placeholder matches in place and returns
+// them.
+func suppressPlaceholders(matches map[string]map[string][]string, placeholders placeholderSet) []SuppressedMatch {
+	var suppressed []SuppressedMatch
+	for path, rules := range matches {
+		for rule, values := range rules {
+			kept := values[:0]
+			for _, value := range values {
+				if isPlaceholder(value, placeholders) {
+					suppressed = append(suppressed, SuppressedMatch{Path: path, Rule: rule, Match: value, Disposition: dispositionPlaceholder})
+					continue
+				}
+				kept = append(kept, value)
+			}
+			if len(kept) == 0 {
+				delete(rules, rule)
+			} else {
+				rules[rule] = kept
+			}
+		}
+		if len(rules) == 0 {
+			delete(matches, path)
+		}
+	}
+	return suppressed
+}
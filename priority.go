@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// scanPriorityDirs hold most of the secrets found in practice: home
+// directories, system and application config, and application code.
+var scanPriorityDirs = []string{"root", "home", "etc", "app", "srv", "opt", "var/www", "usr/src/app", "usr/local/etc", "workspace", "code"}
+
+// scanPriorityNames are configuration directories found at any depth.
+var scanPriorityNames = map[string]bool{".aws": true, ".ssh": true, ".docker": true, ".kube": true, ".config": true, ".gnupg": true, "config": true, "secrets": true}
+
+type layerFile struct {
+	path string
+	info os.FileInfo
+}
+
+// scanPriority ranks a path inside a layer: well-known secret files first,
+// then files under high-value directories, then everything else.
+func scanPriority(rel string) int {
+	if isSensitiveFile("/" + rel) {
+		return 0
+	}
+	slashed := filepath.ToSlash(rel)
+	for _, dir := range scanPriorityDirs {
+		if isUnder(slashed, dir) {
+			return 1
+		}
+	}
+	parts := strings.Split(slashed, "/")
+	for _, part := range parts[:len(parts)-1] {
+		if scanPriorityNames[part] {
+			return 1
+		}
+	}
+	return 2
+}
+
+// sortByScanPriority orders files so that findings in likely places stream
+// out first, keeping the walk order within each rank.
+func sortByScanPriority(files []layerFile, relative func(string) string) {
+	ranks := make(map[string]int, len(files))
+	for _, file := range files {
+		ranks[file.path] = scanPriority(relative(file.path))
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		return ranks[files[i].path] < ranks[files[j].path]
+	})
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// ProbeResult describes what a registry supports, as found by dockerspy
+// probe.
+type ProbeResult struct {
+	Registry   string           `json:"registry"`
+	BaseURL    string           `json:"baseURL"`
+	Status     string           `json:"status"`
+	APIVersion string           `json:"apiVersion,omitempty"`
+	Auth       ProbeAuth        `json:"auth"`
+	Catalog    string           `json:"catalog"`
+	Repository string           `json:"repository,omitempty"`
+	MediaTypes []ProbeMediaType `json:"manifestMediaTypes,omitempty"`
+	Referrers  string           `json:"referrers,omitempty"`
+	RateLimit  *PullBudget      `json:"rateLimit,omitempty"`
+	Problems   []string         `json:"problems,omitempty"`
+}
+
+type ProbeAuth struct {
+	Scheme      string `json:"scheme"`
+	Realm       string `json:"realm,omitempty"`
+	Service     string `json:"service,omitempty"`
+	Credentials bool   `json:"credentials"`
+	Token       string `json:"token"`
+}
+
+// ProbeMediaType is how the registry answered a manifest request accepting
+// only MediaType.
+type ProbeMediaType struct {
+	MediaType   string `json:"mediaType"`
+	Status      int    `json:"status"`
+	ContentType string `json:"contentType,omitempty"`
+}
+
+// probeTarget splits the probe argument into a registry and, when one was
+// named, a repository to test manifest and referrer support against. The
+// --username credentials are scoped to that registry.
+func probeTarget(arg string) (imageRef, bool) {
+	if !strings.Contains(arg, "/") {
+		registry := arg
+		switch registry {
+		case "index.docker.io", "registry-1.docker.io", "registry.hub.docker.com":
+			registry = dockerHubRegistry
+		}
+		scopeCLIRegistry(registry)
+		return imageRef{Registry: registry, Tag: "latest"}, false
+	}
+	scopeCLICredentials(arg)
+	return parseImageReference(arg), true
+}
+
+// probeRegistry asks the registry about its API, authentication, catalog,
+// manifest formats, referrers and rate limits. Only HEAD requests touch
+// manifests, so probing Docker Hub does not spend pulls.
+func probeRegistry(ctx context.Context, ref imageRef, withRepo bool) (*ProbeResult, error) {
+	result := &ProbeResult{Registry: ref.Registry, BaseURL: registryBaseURL(ref.Registry)}
+
+	resp, err := probeGet(ctx, result.BaseURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	result.Status = resp.Status
+	result.APIVersion = resp.Header.Get("Docker-Distribution-API-Version")
+	challenge := parseAuthChallenge(resp.Header.Get("WWW-Authenticate"))
+	if resp.StatusCode != http.StatusUnauthorized {
+		challenge = authChallenge{}
+	}
+	result.Auth = ProbeAuth{Scheme: challenge.scheme, Realm: challenge.params["realm"], Service: challenge.params["service"]}
+	if result.Auth.Scheme == "" {
+		result.Auth.Scheme = "none"
+	}
+	username, _ := registryCredentials(ref.Registry)
+	result.Auth.Credentials = username != ""
+
+	repos := probeCatalog(ctx, result)
+	if !withRepo {
+		switch {
+		case ref.isDockerHub():
+			ref.Repo = "library/alpine"
+		case len(repos) > 0:
+			ref.Repo = repos[0]
+		default:
+			result.Problems = append(result.Problems, "no repository to test manifests against; pass registry/repo[:tag]")
+			return result, nil
+		}
+	}
+	result.Repository = ref.name() + ":" + ref.reference()
+	if ref.Digest != "" {
+		result.Repository = ref.String()
+	}
+
+	s, err := newRegistrySession(ctx, ref)
+	if err != nil {
+		result.Auth.Token = "failed"
+		result.Problems = append(result.Problems, fmt.Sprintf("authentication failed: %v", err))
+		return result, nil
+	}
+	switch {
+	case s.token != "":
+		result.Auth.Token = "issued"
+	case s.basic:
+		result.Auth.Token = "basic"
+	default:
+		result.Auth.Token = "not needed"
+	}
+
+	var digest string
+	for _, mediaType := range manifestMediaTypes {
+		req, err := s.newRequest(ctx, "HEAD", fmt.Sprintf("%s%s/manifests/%s", s.baseURL, s.repo, ref.reference()))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", mediaType)
+		resp, err := s.do(httpClient, req)
+		if err != nil {
+			result.Problems = append(result.Problems, fmt.Sprintf("manifest request for %s failed: %v", mediaType, err))
+			continue
+		}
+		resp.Body.Close()
+		recordPullBudget(s.baseURL, resp.Header)
+		result.MediaTypes = append(result.MediaTypes, ProbeMediaType{MediaType: mediaType, Status: resp.StatusCode, ContentType: resp.Header.Get("Content-Type")})
+		if digest == "" && resp.StatusCode == http.StatusOK {
+			digest = resp.Header.Get("Docker-Content-Digest")
+		}
+	}
+	result.RateLimit = pullBudgetFor(s.baseURL)
+
+	if digest == "" {
+		result.Referrers = "unknown (no manifest digest)"
+		return result, nil
+	}
+	req, err := s.newRequest(ctx, "GET", fmt.Sprintf("%s%s/referrers/%s", s.baseURL, s.repo, digest))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", mediaTypeOCIIndex)
+	resp, err = s.do(httpClient, req)
+	if err != nil {
+		result.Referrers = fmt.Sprintf("unknown (%v)", err)
+		return result, nil
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusOK && strings.HasPrefix(resp.Header.Get("Content-Type"), mediaTypeOCIIndex):
+		var index ImageIndex
+		json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&index)
+		result.Referrers = fmt.Sprintf("supported (%d for this manifest)", len(index.Manifests))
+	case resp.StatusCode == http.StatusNotFound:
+		result.Referrers = "not supported"
+	default:
+		result.Referrers = "unknown (" + resp.Status + ")"
+	}
+	return result, nil
+}
+
+// probeCatalog lists a few repositories, which most public registries
+// refuse.
+func probeCatalog(ctx context.Context, result *ProbeResult) []string {
+	resp, err := probeGet(ctx, result.BaseURL+"_catalog?n=10", func(req *http.Request) {
+		if username, password := registryCredentials(result.Registry); username != "" {
+			req.SetBasicAuth(username, password)
+		}
+	})
+	if err != nil {
+		result.Catalog = fmt.Sprintf("unknown (%v)", err)
+		return nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		result.Catalog = "not available (" + resp.Status + ")"
+		return nil
+	}
+	var catalog struct {
+		Repositories []string `json:"repositories"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&catalog); err != nil {
+		result.Catalog = "invalid response"
+		return nil
+	}
+	result.Catalog = "available"
+	return catalog.Repositories
+}
+
+func probeGet(ctx context.Context, url string, prepare func(*http.Request)) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if prepare != nil {
+		prepare(req)
+	}
+	return httpClient.Do(req)
+}
+
+func formatProbe(w io.Writer, result *ProbeResult) {
+	fmt.Fprintf(w, "Registry:      %s (%s)\n", result.Registry, result.BaseURL)
+	fmt.Fprintf(w, "/v2/:          %s\n", result.Status)
+	if result.APIVersion != "" {
+		fmt.Fprintf(w, "API version:   %s\n", result.APIVersion)
+	}
+	fmt.Fprintf(w, "Auth:          %s", result.Auth.Scheme)
+	if result.Auth.Realm != "" {
+		fmt.Fprintf(w, " realm=%s", result.Auth.Realm)
+	}
+	if result.Auth.Service != "" {
+		fmt.Fprintf(w, " service=%s", result.Auth.Service)
+	}
+	fmt.Fprintf(w, " (credentials configured: %t)\n", result.Auth.Credentials)
+	if result.Auth.Token != "" {
+		fmt.Fprintf(w, "Token:         %s\n", result.Auth.Token)
+	}
+	fmt.Fprintf(w, "Catalog:       %s\n", result.Catalog)
+	if result.Repository != "" {
+		fmt.Fprintf(w, "Tested with:   %s\n", result.Repository)
+	}
+	if len(result.MediaTypes) > 0 {
+		fmt.Fprintln(w, "Manifest media types:")
+		for _, mediaType := range result.MediaTypes {
+			served := mediaType.ContentType
+			if mediaType.Status != http.StatusOK {
+				served = http.StatusText(mediaType.Status)
+			}
+			fmt.Fprintf(w, "  %-70s %d %s\n", mediaType.MediaType, mediaType.Status, served)
+		}
+	}
+	if result.Referrers != "" {
+		fmt.Fprintf(w, "Referrers API: %s\n", result.Referrers)
+	}
+	if result.RateLimit != nil {
+		fmt.Fprintf(w, "Rate limit:    %d of %d pulls left per %s\n", result.RateLimit.Remaining, result.RateLimit.Limit, result.RateLimit.Window)
+	} else if result.Repository != "" {
+		fmt.Fprintln(w, "Rate limit:    none advertised")
+	}
+	for _, problem := range result.Problems {
+		fmt.Fprintf(w, "Problem:       %s\n", problem)
+	}
+}
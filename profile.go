@@ -0,0 +1,136 @@
+package main
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// scanProfile bundles what a scan looks at. quick never writes layer
+// contents to disk; deep also reads files the ignore list would skip, pulls
+// printable strings out of binaries, scans embedded images and scans every
+// platform of a multi-platform tag.
+type scanProfile struct {
+	Name             string
+	FileContents     bool
+	ConfigEnv        bool
+	SensitiveNames   bool
+	IgnoreExtensions bool
+	BinaryStrings    bool
+	NestedImages     bool
+	AllPlatforms     bool
+}
+
+var scanProfiles = map[string]scanProfile{
+	"quick": {
+		Name:           "quick",
+		ConfigEnv:      true,
+		SensitiveNames: true,
+	},
+	"standard": {
+		Name:             "standard",
+		FileContents:     true,
+		ConfigEnv:        true,
+		IgnoreExtensions: true,
+	},
+	"deep": {
+		Name:           "deep",
+		FileContents:   true,
+		ConfigEnv:      true,
+		SensitiveNames: true,
+		BinaryStrings:  true,
+		NestedImages:   true,
+		AllPlatforms:   true,
+	},
+}
+
+func profileNames() string {
+	names := make([]string, 0, len(scanProfiles))
+	for name := range scanProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+const sensitiveFileRule = "sensitive_filename"
+
+var sensitiveFileNames = map[string]bool{
+	"id_rsa":               true,
+	"id_dsa":               true,
+	"id_ecdsa":             true,
+	"id_ed25519":           true,
+	".env":                 true,
+	".npmrc":               true,
+	".pypirc":              true,
+	".netrc":               true,
+	".pgpass":              true,
+	".htpasswd":            true,
+	".git-credentials":     true,
+	".dockercfg":           true,
+	"credentials.json":     true,
+	"service-account.json": true,
+	"terraform.tfstate":    true,
+	"wp-config.php":        true,
+}
+
+var sensitiveFileSuffixes = []string{
+	".pem",
+	".key",
+	".p12",
+	".pfx",
+	".jks",
+	".keystore",
+	".ovpn",
+	"/.aws/credentials",
+	"/.docker/config.json",
+	"/.kube/config",
+	"/.ssh/authorized_keys",
+}
+
+func isSensitiveFile(path string) bool {
+	if sensitiveFileNames[filepath.Base(path)] {
+		return true
+	}
+	slashed := filepath.ToSlash(path)
+	for _, suffix := range sensitiveFileSuffixes {
+		if strings.HasSuffix(slashed, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// scanEnv matches the environment baked into the image config. Results are
+// keyed "env:<NAME>" like labels are keyed "label:<key>".
+func scanEnv(env []string, patterns map[string]Matcher) map[string]map[string][]string {
+	matches := make(map[string]map[string][]string)
+	for _, variable := range env {
+		name := strings.SplitN(variable, "=", 2)[0]
+		if found := checkPatterns(variable, patterns); len(found) > 0 {
+			matches["env:"+name] = found
+		}
+	}
+	return matches
+}
+
+// printableStrings returns runs of at least minLen printable ASCII bytes,
+// one per line, like strings(1).
+func printableStrings(data []byte, minLen int) string {
+	var b strings.Builder
+	start := -1
+	for i := 0; i <= len(data); i++ {
+		if i < len(data) && data[i] >= 0x20 && data[i] < 0x7f {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 && i-start >= minLen {
+			b.Write(data[start:i])
+			b.WriteByte('\n')
+		}
+		start = -1
+	}
+	return b.String()
+}
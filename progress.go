@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type layerBar struct {
+	digest string
+	total  int64
+	done   int64
+	status string
+}
+
+type imageProgress struct {
+	name        string
+	layers      []*layerBar
+	start       time.Time
+	transferred int64
+}
+
+// progressBoard draws one bar per layer plus an aggregate line per image at
+// the bottom of the terminal. Log lines are printed above it by clearing the
+// board, writing the line and drawing the board again.
+type progressBoard struct {
+	mu       sync.Mutex
+	out      io.Writer
+	enabled  bool
+	images   []*imageProgress
+	lines    int
+	lastDraw time.Time
+}
+
+var progress = &progressBoard{out: os.Stderr}
+
+type layerBarKey struct{}
+
+func withLayerBar(ctx context.Context, bar *layerBar) context.Context {
+	return context.WithValue(ctx, layerBarKey{}, bar)
+}
+
+func layerBarFrom(ctx context.Context) *layerBar {
+	bar, _ := ctx.Value(layerBarKey{}).(*layerBar)
+	return bar
+}
+
+func (pb *progressBoard) startImage(name string, layers []Descriptor) *imageProgress {
+	ip := &imageProgress{name: name, start: time.Now()}
+	for _, layer := range layers {
+		ip.layers = append(ip.layers, &layerBar{digest: layer.Digest, total: layer.Size, status: "queued"})
+	}
+
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	pb.images = append(pb.images, ip)
+	pb.draw(true)
+	return ip
+}
+
+func (pb *progressBoard) finishImage(ip *imageProgress) {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	for i, image := range pb.images {
+		if image == ip {
+			pb.images = append(pb.images[:i], pb.images[i+1:]...)
+			break
+		}
+	}
+	pb.draw(true)
+}
+
+func (pb *progressBoard) setStatus(bar *layerBar, status string) {
+	if bar == nil {
+		return
+	}
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	bar.status = status
+	if status == "cached" {
+		bar.done = bar.total
+	}
+	pb.draw(true)
+}
+
+func (pb *progressBoard) advance(bar *layerBar, n int64) {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	bar.done += n
+	for _, ip := range pb.images {
+		for _, layer := range ip.layers {
+			if layer == bar {
+				ip.transferred += n
+			}
+		}
+	}
+	pb.draw(false)
+}
+
+func (pb *progressBoard) setDone(bar *layerBar, done int64) {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	bar.done = done
+}
+
+// around runs write with the board cleared so the output lands above it.
+func (pb *progressBoard) around(write func() error) error {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	pb.clear()
+	err := write()
+	pb.draw(true)
+	return err
+}
+
+func (pb *progressBoard) clear() {
+	if pb.lines > 0 {
+		fmt.Fprintf(pb.out, "\033[%dA\033[J", pb.lines)
+		pb.lines = 0
+	}
+}
+
+func (pb *progressBoard) draw(force bool) {
+	if !pb.enabled || (!force && time.Since(pb.lastDraw) < 100*time.Millisecond) {
+		return
+	}
+	pb.lastDraw = time.Now()
+
+	var b strings.Builder
+	lines := 0
+	for _, ip := range pb.images {
+		var total, done int64
+		for _, layer := range ip.layers {
+			total += layer.total
+			done += layer.done
+		}
+		fmt.Fprintf(&b, "%s  %s / %s  %s  ETA %s\n", ip.name, formatBytes(done), formatBytes(total), percent(done, total), ip.eta(total-done))
+		lines++
+		for _, layer := range ip.layers {
+			fmt.Fprintf(&b, "  %-19.19s %s %s  %s\n", layer.digest, bar(layer.done, layer.total, 20), percent(layer.done, layer.total), layer.status)
+			lines++
+		}
+	}
+
+	pb.clear()
+	io.WriteString(pb.out, b.String())
+	pb.lines = lines
+}
+
+func (ip *imageProgress) eta(remaining int64) string {
+	elapsed := time.Since(ip.start)
+	if remaining <= 0 {
+		return "0s"
+	}
+	if ip.transferred == 0 || elapsed <= 0 {
+		return "--"
+	}
+	rate := float64(ip.transferred) / elapsed.Seconds()
+	return time.Duration(float64(remaining) / rate * float64(time.Second)).Round(time.Second).String()
+}
+
+func bar(done, total int64, width int) string {
+	filled := width
+	if total > 0 && done < total {
+		filled = int(done * int64(width) / total)
+	}
+	return "[" + strings.Repeat("#", filled) + strings.Repeat(".", width-filled) + "]"
+}
+
+func percent(done, total int64) string {
+	if total <= 0 {
+		return "  --%"
+	}
+	if done > total {
+		done = total
+	}
+	return fmt.Sprintf("%3d%%", done*100/total)
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
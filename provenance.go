@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+)
+
+const (
+	attestationReferenceType = "attestation-manifest"
+	inTotoPredicateType      = "in-toto.io/predicate-type"
+	maxAttestationSize       = 8 << 20
+)
+
+type Provenance struct {
+	PredicateType  string                 `json:"predicateType"`
+	BuilderID      string                 `json:"builderId,omitempty"`
+	BuildType      string                 `json:"buildType,omitempty"`
+	SourceRepo     string                 `json:"sourceRepo,omitempty"`
+	SourceRevision string                 `json:"sourceRevision,omitempty"`
+	EntryPoint     string                 `json:"entryPoint,omitempty"`
+	StartedOn      string                 `json:"startedOn,omitempty"`
+	FinishedOn     string                 `json:"finishedOn,omitempty"`
+	Parameters     map[string]interface{} `json:"parameters,omitempty"`
+	Materials      []string               `json:"materials,omitempty"`
+}
+
+type inTotoStatement struct {
+	PredicateType string          `json:"predicateType"`
+	Predicate     json.RawMessage `json:"predicate"`
+}
+
+type material struct {
+	URI    string            `json:"uri"`
+	Digest map[string]string `json:"digest"`
+}
+
+type buildkitMetadata struct {
+	VCS struct {
+		Source   string `json:"source"`
+		Revision string `json:"revision"`
+	} `json:"vcs"`
+}
+
+type slsaV02Predicate struct {
+	Builder struct {
+		ID string `json:"id"`
+	} `json:"builder"`
+	BuildType  string `json:"buildType"`
+	Invocation struct {
+		ConfigSource struct {
+			URI        string            `json:"uri"`
+			Digest     map[string]string `json:"digest"`
+			EntryPoint string            `json:"entryPoint"`
+		} `json:"configSource"`
+		Parameters map[string]interface{} `json:"parameters"`
+	} `json:"invocation"`
+	Metadata struct {
+		BuildStartedOn  string           `json:"buildStartedOn"`
+		BuildFinishedOn string           `json:"buildFinishedOn"`
+		Buildkit        buildkitMetadata `json:"https://mobyproject.org/buildkit@v1#metadata"`
+	} `json:"metadata"`
+	Materials []material `json:"materials"`
+}
+
+type slsaV1Predicate struct {
+	BuildDefinition struct {
+		BuildType          string                 `json:"buildType"`
+		ExternalParameters map[string]interface{} `json:"externalParameters"`
+		ResolvedDeps       []material             `json:"resolvedDependencies"`
+	} `json:"buildDefinition"`
+	RunDetails struct {
+		Builder struct {
+			ID string `json:"id"`
+		} `json:"builder"`
+		Metadata struct {
+			StartedOn  string           `json:"startedOn"`
+			FinishedOn string           `json:"finishedOn"`
+			Buildkit   buildkitMetadata `json:"buildkit_metadata"`
+		} `json:"metadata"`
+	} `json:"runDetails"`
+}
+
+func getProvenance(ctx context.Context, s *registrySession, reference string) ([]Provenance, error) {
+	body, err := fetchManifest(ctx, s, reference, mediaTypeOCIIndex, mediaTypeDockerManifestList)
+	if err != nil {
+		return nil, err
+	}
+
+	var index ImageIndex
+	if err := json.Unmarshal(body, &index); err != nil {
+		return nil, err
+	}
+
+	var provenance []Provenance
+	for _, entry := range index.Manifests {
+		if entry.Annotations["vnd.docker.reference.type"] != attestationReferenceType {
+			continue
+		}
+
+		body, err := fetchManifest(ctx, s, entry.Digest, mediaTypeOCIManifest)
+		if err != nil {
+			return provenance, err
+		}
+
+		var attestation Manifest
+		if err := json.Unmarshal(body, &attestation); err != nil {
+			return provenance, err
+		}
+
+		for _, layer := range attestation.Layers {
+			if !strings.Contains(layer.Annotations[inTotoPredicateType], "slsa.dev/provenance") {
+				continue
+			}
+
+			blob, err := fetchBlob(ctx, s, layer.Digest, maxAttestationSize)
+			if err != nil {
+				return provenance, err
+			}
+
+			parsed, err := parseProvenance(blob)
+			if err != nil {
+				return provenance, err
+			}
+			provenance = append(provenance, *parsed)
+		}
+	}
+
+	return provenance, nil
+}
+
+func parseProvenance(data []byte) (*Provenance, error) {
+	var statement inTotoStatement
+	if err := json.Unmarshal(data, &statement); err != nil {
+		return nil, err
+	}
+
+	result := &Provenance{PredicateType: statement.PredicateType}
+	if strings.HasSuffix(statement.PredicateType, "/v1") {
+		var predicate slsaV1Predicate
+		if err := json.Unmarshal(statement.Predicate, &predicate); err != nil {
+			return nil, err
+		}
+		result.BuilderID = predicate.RunDetails.Builder.ID
+		result.BuildType = predicate.BuildDefinition.BuildType
+		result.StartedOn = predicate.RunDetails.Metadata.StartedOn
+		result.FinishedOn = predicate.RunDetails.Metadata.FinishedOn
+		result.Parameters = predicate.BuildDefinition.ExternalParameters
+		result.SourceRepo = predicate.RunDetails.Metadata.Buildkit.VCS.Source
+		result.SourceRevision = predicate.RunDetails.Metadata.Buildkit.VCS.Revision
+		if source, ok := predicate.BuildDefinition.ExternalParameters["configSource"].(map[string]interface{}); ok {
+			if uri, ok := source["uri"].(string); ok && result.SourceRepo == "" {
+				result.SourceRepo = uri
+			}
+			if path, ok := source["path"].(string); ok {
+				result.EntryPoint = path
+			}
+		}
+		for _, dep := range predicate.BuildDefinition.ResolvedDeps {
+			result.Materials = append(result.Materials, dep.URI)
+		}
+		return result, nil
+	}
+
+	var predicate slsaV02Predicate
+	if err := json.Unmarshal(statement.Predicate, &predicate); err != nil {
+		return nil, err
+	}
+	result.BuilderID = predicate.Builder.ID
+	result.BuildType = predicate.BuildType
+	result.StartedOn = predicate.Metadata.BuildStartedOn
+	result.FinishedOn = predicate.Metadata.BuildFinishedOn
+	result.Parameters = predicate.Invocation.Parameters
+	result.EntryPoint = predicate.Invocation.ConfigSource.EntryPoint
+	result.SourceRepo = predicate.Metadata.Buildkit.VCS.Source
+	result.SourceRevision = predicate.Metadata.Buildkit.VCS.Revision
+	if result.SourceRepo == "" {
+		result.SourceRepo = predicate.Invocation.ConfigSource.URI
+	}
+	for _, m := range predicate.Materials {
+		result.Materials = append(result.Materials, m.URI)
+	}
+	return result, nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PullBudget is what a registry reported about its pull rate limit in the
+// ratelimit-limit and ratelimit-remaining headers, as Docker Hub does on
+// every manifest request.
+type PullBudget struct {
+	Limit     int           `json:"limit"`
+	Remaining int           `json:"remaining"`
+	Window    time.Duration `json:"window"`
+	Updated   time.Time     `json:"updated"`
+}
+
+// pullReserve, set with --pull-reserve, is how many pulls are left untouched:
+// manifest requests pause once the budget falls to it. -1 never pauses.
+var pullReserve = 2
+
+var (
+	pullBudgetsMu sync.Mutex
+	pullBudgets   = make(map[string]PullBudget)
+)
+
+// parseRateLimitHeader reads a value such as "100;w=21600" into the count and
+// the window it applies to.
+func parseRateLimitHeader(value string) (int, time.Duration, bool) {
+	countPart, params, _ := strings.Cut(value, ";")
+	count, err := strconv.Atoi(strings.TrimSpace(countPart))
+	if err != nil {
+		return 0, 0, false
+	}
+	var window time.Duration
+	for _, param := range strings.Split(params, ";") {
+		if key, seconds, ok := strings.Cut(strings.TrimSpace(param), "="); ok && key == "w" {
+			if n, err := strconv.Atoi(seconds); err == nil {
+				window = time.Duration(n) * time.Second
+			}
+		}
+	}
+	return count, window, true
+}
+
+// recordPullBudget keeps the budget reported for registry. Registries that
+// do not limit pulls send no headers and are left alone.
+func recordPullBudget(registry string, header http.Header) {
+	limit, window, ok := parseRateLimitHeader(header.Get("RateLimit-Limit"))
+	if !ok {
+		return
+	}
+	remaining, remainingWindow, ok := parseRateLimitHeader(header.Get("RateLimit-Remaining"))
+	if !ok {
+		return
+	}
+	if window == 0 {
+		window = remainingWindow
+	}
+	pullBudgetsMu.Lock()
+	pullBudgets[registry] = PullBudget{Limit: limit, Remaining: remaining, Window: window, Updated: time.Now().UTC()}
+	pullBudgetsMu.Unlock()
+}
+
+func pullBudgetFor(registry string) *PullBudget {
+	pullBudgetsMu.Lock()
+	defer pullBudgetsMu.Unlock()
+	budget, ok := pullBudgets[registry]
+	if !ok {
+		return nil
+	}
+	return &budget
+}
+
+// waitForPullBudget pauses while registry has no more than pullReserve pulls
+// left, rather than letting the sweep fail with 429 halfway. The limit is a
+// sliding window, so each pull comes back after window/limit on average.
+func waitForPullBudget(ctx context.Context, registry string) error {
+	budget := pullBudgetFor(registry)
+	if pullReserve < 0 || budget == nil || budget.Remaining > pullReserve || budget.Limit <= 0 || budget.Window <= 0 {
+		return nil
+	}
+	pause := budget.Window / time.Duration(budget.Limit) * time.Duration(pullReserve-budget.Remaining+1)
+	if wait := time.Until(budget.Updated.Add(pause)); wait > 0 {
+		logger.Warn("pull budget nearly exhausted, pausing", "registry", registry, "remaining", budget.Remaining, "limit", budget.Limit, "resumeAt", time.Now().Add(wait).Format(time.TimeOnly))
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+	return nil
+}
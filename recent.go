@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const maxRecentRepos = 200
+
+func recentReposPath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "dockerspy", "recent_repos.json")
+}
+
+func loadRecentRepos() []string {
+	data, err := os.ReadFile(recentReposPath())
+	if err != nil {
+		return nil
+	}
+	var repos []string
+	if err := json.Unmarshal(data, &repos); err != nil {
+		return nil
+	}
+	return repos
+}
+
+func recordRecentRepos(names []string) error {
+	seen := make(map[string]bool)
+	var repos []string
+	for _, name := range append(names, loadRecentRepos()...) {
+		if seen[name] || name == "" {
+			continue
+		}
+		seen[name] = true
+		repos = append(repos, name)
+		if len(repos) == maxRecentRepos {
+			break
+		}
+	}
+
+	data, err := json.Marshal(repos)
+	if err != nil {
+		return err
+	}
+	path := recentReposPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o600)
+}
+
+func completeRecentRepos(prefix string) []string {
+	var matches []string
+	for _, repo := range loadRecentRepos() {
+		if strings.HasPrefix(repo, prefix) {
+			matches = append(matches, repo)
+		}
+	}
+	return matches
+}
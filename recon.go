@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ReconReport profiles everything a Docker Hub user or organization
+// publishes.
+type ReconReport struct {
+	Namespace    string            `json:"namespace"`
+	Generated    time.Time         `json:"generated"`
+	Repositories []ReconRepository `json:"repositories"`
+}
+
+type ReconRepository struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Pulls       int    `json:"pulls"`
+	Stars       int    `json:"stars"`
+	Official    bool   `json:"official,omitempty"`
+	LastPushed  string `json:"lastPushed,omitempty"`
+	Tags        int    `json:"tags"`
+	Readme      string `json:"readme,omitempty"`
+	Dockerfile  string `json:"dockerfile,omitempty"`
+	// Findings holds regex matches in the README ("hub:readme") and the
+	// Dockerfile ("hub:dockerfile"), keyed like the matches of a scan.
+	Findings   map[string]map[string][]string `json:"findings,omitempty"`
+	Suppressed []SuppressedMatch              `json:"suppressed,omitempty"`
+	Error      string                         `json:"error,omitempty"`
+}
+
+// reconScanner scans the documents Docker Hub publishes for each
+// repository. Placeholder matches are set aside as in image scans, since
+// READMEs are full of example credentials.
+type reconScanner struct {
+	patterns     map[string]Matcher
+	placeholders placeholderSet
+}
+
+// buildRecon lists the namespace and counts the tags of each repository,
+// most pulled first. With a scanner, it also fetches and scans each README
+// and published Dockerfile. A repository whose details cannot be read keeps
+// the error instead of failing the whole report.
+func buildRecon(namespace string, scanner *reconScanner) (*ReconReport, error) {
+	repos, err := listNamespaceRepositories(namespace, "")
+	if err != nil {
+		return nil, err
+	}
+	report := &ReconReport{Namespace: namespace, Generated: time.Now().UTC()}
+	for _, repo := range repos {
+		entry := ReconRepository{
+			Name:        repo.Name,
+			Description: repo.Description,
+			Pulls:       repo.PullCount,
+			Stars:       repo.StarCount,
+			Official:    repo.IsOfficial,
+			LastPushed:  repo.LastUpdated,
+		}
+		if count, err := countTags(repo.Name); err != nil {
+			entry.Error = err.Error()
+		} else {
+			entry.Tags = count
+		}
+		if scanner != nil && entry.Error == "" {
+			if err := scanner.scan(&entry); err != nil {
+				entry.Error = err.Error()
+			}
+		}
+		report.Repositories = append(report.Repositories, entry)
+	}
+	sort.SliceStable(report.Repositories, func(i, j int) bool {
+		return report.Repositories[i].Pulls > report.Repositories[j].Pulls
+	})
+	return report, nil
+}
+
+// countTags reads the total from a one-item page instead of listing tags.
+func countTags(repo string) (int, error) {
+	data, err := hubGet(fmt.Sprintf("https://hub.docker.com/v2/repositories/%s/tags?page_size=1", hubRepoPath(repo)), "count tags")
+	if err != nil {
+		return 0, err
+	}
+	var page TagsResult
+	if err := json.Unmarshal(data, &page); err != nil {
+		return 0, err
+	}
+	return page.Count, nil
+}
+
+// fetchHubDocs reads the full description of repo, the README shown on its
+// Hub page, and the Dockerfile Hub publishes for automated builds. Most
+// repositories have no Dockerfile, which is not an error.
+func fetchHubDocs(repo string) (readme, dockerfile string, err error) {
+	base := fmt.Sprintf("https://hub.docker.com/v2/repositories/%s/", hubRepoPath(repo))
+	data, err := hubGet(base, "fetch repository")
+	if err != nil {
+		return "", "", err
+	}
+	var details struct {
+		FullDescription string `json:"full_description"`
+	}
+	if err := json.Unmarshal(data, &details); err != nil {
+		return "", "", err
+	}
+
+	data, err = hubGet(base+"dockerfile/", "fetch Dockerfile")
+	if isErrorKind(err, ErrNotFound) {
+		return details.FullDescription, "", nil
+	}
+	if err != nil {
+		return "", "", err
+	}
+	var published struct {
+		Contents string `json:"contents"`
+	}
+	if err := json.Unmarshal(data, &published); err != nil {
+		return "", "", err
+	}
+	return details.FullDescription, published.Contents, nil
+}
+
+func (s *reconScanner) scan(entry *ReconRepository) error {
+	readme, dockerfile, err := fetchHubDocs(entry.Name)
+	if err != nil {
+		return err
+	}
+	entry.Readme, entry.Dockerfile = readme, dockerfile
+	matches := make(map[string]map[string][]string)
+	for source, content := range map[string]string{"hub:readme": readme, "hub:dockerfile": dockerfile} {
+		if found := checkPatterns(content, s.patterns); len(found) > 0 {
+			matches[source] = found
+		}
+	}
+	entry.Suppressed = suppressPlaceholders(matches, s.placeholders)
+	if len(matches) > 0 {
+		entry.Findings = matches
+	}
+	return nil
+}
+
+// findingCount is the number of matches in the README and Dockerfile.
+func (r ReconRepository) findingCount() int {
+	count := 0
+	for _, rules := range r.Findings {
+		for _, values := range rules {
+			count += len(values)
+		}
+	}
+	return count
+}
+
+func formatRecon(report *ReconReport, format string) ([]byte, error) {
+	var buf bytes.Buffer
+	switch format {
+	case "json":
+		data, err := json.MarshalIndent(report, "", "  ")
+		return append(data, '\n'), err
+	case "csv":
+		w := csv.NewWriter(&buf)
+		w.Write([]string{"name", "description", "pulls", "stars", "official", "last_pushed", "tags", "findings", "error"})
+		for _, repo := range report.Repositories {
+			w.Write([]string{repo.Name, repo.Description, strconv.Itoa(repo.Pulls), strconv.Itoa(repo.Stars), strconv.FormatBool(repo.Official), repo.LastPushed, strconv.Itoa(repo.Tags), strconv.Itoa(repo.findingCount()), repo.Error})
+		}
+		w.Flush()
+		return buf.Bytes(), w.Error()
+	case "", "text":
+		fmt.Fprintf(&buf, "%d repositories in %s\n\n", len(report.Repositories), report.Namespace)
+		for _, repo := range report.Repositories {
+			pushed := repo.LastPushed
+			if len(pushed) > len("2006-01-02") {
+				pushed = pushed[:len("2006-01-02")]
+			}
+			fmt.Fprintf(&buf, "%s\t%d pulls\t%d stars\t%d tags\tpushed %s\t%s\n", repo.Name, repo.Pulls, repo.Stars, repo.Tags, pushed, repo.Description)
+			for _, source := range []string{"hub:readme", "hub:dockerfile"} {
+				rules := make([]string, 0, len(repo.Findings[source]))
+				for rule := range repo.Findings[source] {
+					rules = append(rules, rule)
+				}
+				sort.Strings(rules)
+				for _, rule := range rules {
+					for _, match := range repo.Findings[source][rule] {
+						fmt.Fprintf(&buf, "  [%s] %s: %s\n", strings.TrimPrefix(source, "hub:"), rule, match)
+					}
+				}
+			}
+		}
+		return buf.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("unknown recon format: %s", format)
+	}
+}
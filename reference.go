@@ -0,0 +1,106 @@
+package main
+
+import (
+	"strings"
+)
+
+const dockerHubRegistry = "docker.io"
+
+// imageRef is a parsed image reference such as nginx:1.27,
+// docker.io/foo/bar:1, ghcr.io/org/app@sha256:... or
+// registry.local:5000/x:y.
+type imageRef struct {
+	Registry string
+	Repo     string
+	Tag      string
+	Digest   string
+	// Platform overrides --platform for manifest lists.
+	Platform *Platform
+}
+
+// parseImageReference follows the docker CLI rules: the first path component
+// names a registry when it contains a dot or a port, or is localhost;
+// otherwise the image is on Docker Hub. A reference without tag or digest
+// means :latest.
+func parseImageReference(ref string) imageRef {
+	r := imageRef{Registry: dockerHubRegistry}
+	if i := strings.Index(ref, "@"); i >= 0 {
+		r.Digest = ref[i+1:]
+		ref = ref[:i]
+	}
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		r.Tag = ref[i+1:]
+		ref = ref[:i]
+	}
+	if i := strings.Index(ref, "/"); i >= 0 {
+		host := ref[:i]
+		if strings.ContainsAny(host, ".:") || host == "localhost" {
+			r.Registry = host
+			ref = ref[i+1:]
+		}
+	}
+	switch r.Registry {
+	case "index.docker.io", "registry-1.docker.io", "registry.hub.docker.com":
+		r.Registry = dockerHubRegistry
+	}
+	r.Repo = ref
+	if r.Tag == "" && r.Digest == "" {
+		r.Tag = "latest"
+	}
+	return r
+}
+
+func (r imageRef) isDockerHub() bool {
+	return r.Registry == dockerHubRegistry
+}
+
+// path is the repository name used in registry API calls.
+func (r imageRef) path() string {
+	if r.isDockerHub() {
+		return hubRepoPath(r.Repo)
+	}
+	return r.Repo
+}
+
+// name is the repository as shown to users: bare for Docker Hub, prefixed
+// with the registry otherwise.
+func (r imageRef) name() string {
+	if r.isDockerHub() {
+		return r.Repo
+	}
+	return r.Registry + "/" + r.Repo
+}
+
+// reference is what the manifest is fetched by: the digest when pinned,
+// the tag otherwise.
+func (r imageRef) reference() string {
+	if r.Digest != "" {
+		return r.Digest
+	}
+	return r.Tag
+}
+
+// platform is the image picked when the reference names a multi-platform
+// manifest list.
+func (r imageRef) platform() Platform {
+	if r.Platform != nil {
+		return *r.Platform
+	}
+	return selectedPlatform
+}
+
+// label is String with the platform added when one was picked for this
+// reference rather than by --platform.
+func (r imageRef) label() string {
+	if r.Platform == nil {
+		return r.String()
+	}
+	return r.String() + " (" + r.Platform.String() + ")"
+}
+
+func (r imageRef) String() string {
+	if r.Digest != "" {
+		return r.name() + "@" + r.Digest
+	}
+	return r.name() + ":" + r.Tag
+}
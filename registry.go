@@ -0,0 +1,678 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+const (
+	dockerHubAPI = "https://registry-1.docker.io/v2/"
+)
+
+type TokenResponse struct {
+	Token       string `json:"token"`
+	AccessToken string `json:"access_token"`
+}
+
+type Manifest struct {
+	Config    Descriptor   `json:"config"`
+	Layers    []Descriptor `json:"layers"`
+	MediaType string       `json:"mediaType"`
+	Digest    string       `json:"-"`
+	Platform  *Platform    `json:"-"`
+
+	legacyConfig *ImageConfig
+}
+
+type Descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Size        int64             `json:"size"`
+	Digest      string            `json:"digest"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	URLs        []string          `json:"urls,omitempty"`
+}
+
+type ImageIndex struct {
+	MediaType string       `json:"mediaType"`
+	Manifests []IndexEntry `json:"manifests"`
+}
+
+type IndexEntry struct {
+	Descriptor
+	Platform *Platform `json:"platform,omitempty"`
+}
+
+type Platform struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+func (p Platform) String() string {
+	if p.Variant != "" {
+		return p.OS + "/" + p.Architecture + "/" + p.Variant
+	}
+	return p.OS + "/" + p.Architecture
+}
+
+// selectedPlatform is the image picked from multi-platform manifest lists,
+// set by --platform.
+var selectedPlatform = Platform{OS: "linux", Architecture: "amd64"}
+
+// parsePlatform reads os/arch[/variant], as docker --platform does.
+func parsePlatform(value string) (Platform, error) {
+	parts := strings.Split(value, "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return Platform{}, fmt.Errorf("invalid platform %q: use os/arch[/variant], e.g. linux/arm64", value)
+	}
+	p := Platform{OS: parts[0], Architecture: parts[1]}
+	if len(parts) == 3 {
+		p.Variant = parts[2]
+	}
+	return p, nil
+}
+
+// matches reports whether an index entry for candidate serves p. A
+// requested platform without variant accepts any variant.
+func (p Platform) matches(candidate *Platform) bool {
+	if candidate == nil || candidate.OS != p.OS || candidate.Architecture != p.Architecture {
+		return false
+	}
+	return p.Variant == "" || p.Variant == candidate.Variant
+}
+
+// registrySession pulls from one repository of one registry, with whatever
+// authentication the registry asked for.
+type registrySession struct {
+	baseURL  string
+	repo     string
+	username string
+	password string
+	basic    bool
+
+	// Pull tokens expire after a few minutes; do replaces token when the
+	// registry starts rejecting it, so concurrent layer downloads share mu.
+	mu        sync.Mutex
+	token     string
+	challenge authChallenge
+}
+
+type authChallenge struct {
+	scheme string
+	params map[string]string
+}
+
+// Docker Hub's challenge is well known, which saves a round trip per image.
+var dockerHubChallenge = authChallenge{
+	scheme: "bearer",
+	params: map[string]string{"realm": "https://auth.docker.io/token", "service": "registry.docker.io"},
+}
+
+var challengeParamPattern = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+func parseAuthChallenge(header string) authChallenge {
+	scheme, rest, _ := strings.Cut(header, " ")
+	challenge := authChallenge{scheme: strings.ToLower(scheme), params: make(map[string]string)}
+	for _, match := range challengeParamPattern.FindAllStringSubmatch(rest, -1) {
+		challenge.params[strings.ToLower(match[1])] = match[2]
+	}
+	return challenge
+}
+
+// insecureRegistries are spoken to over plain HTTP, set by
+// --insecure-registry. Registries on the loopback interface always are, as
+// with the docker daemon.
+var insecureRegistries []string
+
+func isInsecureRegistry(registry string) bool {
+	host := registry
+	if h, _, err := net.SplitHostPort(registry); err == nil {
+		host = h
+	}
+	if ip := net.ParseIP(host); host == "localhost" || (ip != nil && ip.IsLoopback()) {
+		return true
+	}
+	for _, insecure := range insecureRegistries {
+		if insecure == registry || insecure == host {
+			return true
+		}
+	}
+	return false
+}
+
+// registryMirror, set by --registry-mirror, is the base URL of a mirror or
+// pull-through cache that Docker Hub images are pulled from instead of
+// registry-1.docker.io.
+var registryMirror string
+
+// parseRegistryMirror turns host[:port] or a URL into a registry base URL.
+// Without a scheme, HTTPS is used unless the host is an insecure registry.
+func parseRegistryMirror(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	if !strings.Contains(value, "://") {
+		scheme := "https://"
+		if isInsecureRegistry(strings.TrimRight(value, "/")) {
+			scheme = "http://"
+		}
+		value = scheme + value
+	}
+	u, err := url.Parse(value)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return "", fmt.Errorf("invalid --registry-mirror %q, use host[:port] or an http(s) URL", value)
+	}
+	return u.Scheme + "://" + u.Host + strings.TrimSuffix(strings.TrimSuffix(u.Path, "/"), "/v2") + "/v2/", nil
+}
+
+// mirrorHost is the host of registryMirror, whose credentials are used in
+// place of the Docker Hub account.
+func mirrorHost() string {
+	u, err := url.Parse(registryMirror)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+func registryBaseURL(registry string) string {
+	switch {
+	case registry == dockerHubRegistry && registryMirror != "":
+		return registryMirror
+	case registry == dockerHubRegistry:
+		return dockerHubAPI
+	case isInsecureRegistry(registry):
+		return "http://" + registry + "/v2/"
+	}
+	return "https://" + registry + "/v2/"
+}
+
+// cliUsername and cliPassword are set by --username and --password (or
+// DOCKERSPY_USERNAME and DOCKERSPY_PASSWORD). They are only sent to the
+// registry named by --registry or, without it, to the registries of the
+// images named on the command line, never to a base image's registry.
+var (
+	cliUsername, cliPassword string
+	cliRegistry              string
+	cliRegistries            = make(map[string]bool)
+)
+
+// scopeCLICredentials lets the command line credentials be sent to the
+// registries of refs, unless --registry named the one to use.
+func scopeCLICredentials(refs ...string) {
+	for _, ref := range refs {
+		scopeCLIRegistry(parseImageReference(ref).Registry)
+	}
+}
+
+// scopeCLIRegistry is scopeCLICredentials for a bare registry host.
+func scopeCLIRegistry(registry string) {
+	if cliRegistry != "" {
+		return
+	}
+	cliRegistries[registry] = true
+}
+
+// readPasswordStdin reads the first line of stdin, as docker login
+// --password-stdin does.
+func readPasswordStdin() (string, error) {
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	password := strings.TrimRight(line, "\r\n")
+	if password == "" {
+		return "", fmt.Errorf("no password on stdin")
+	}
+	return password, nil
+}
+
+// registryCredentials returns the username and password configured for a
+// registry: the Docker Hub account for docker.io, the registries section of
+// the config file for everything else. Registries with nothing configured
+// get the credentials from the command line, then whatever docker login
+// stored.
+func registryCredentials(registry string) (string, string) {
+	username, password := settings.Registries[registry].Username, settings.Registries[registry].Password
+	if registry == dockerHubRegistry {
+		username, password = hubCredentials()
+	}
+	switch {
+	case username != "":
+		return username, password
+	case cliUsername != "" && cliRegistries[registry]:
+		return cliUsername, cliPassword
+	}
+	if username, password := dockerConfigCredentials(registry); username != "" {
+		return username, password
+	}
+	return cloudRegistryCredentials(registry)
+}
+
+func newRegistrySession(ctx context.Context, ref imageRef) (*registrySession, error) {
+	s := &registrySession{baseURL: registryBaseURL(ref.Registry), repo: ref.path()}
+	mirrored := ref.isDockerHub() && registryMirror != ""
+	if mirrored {
+		s.username, s.password = registryCredentials(mirrorHost())
+	} else {
+		s.username, s.password = registryCredentials(ref.Registry)
+	}
+
+	challenge := dockerHubChallenge
+	if !ref.isDockerHub() || mirrored {
+		var err error
+		challenge, err = s.discoverChallenge(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch challenge.scheme {
+	case "":
+	case "basic":
+		s.basic = true
+	case "bearer":
+		token, err := s.fetchToken(ctx, challenge)
+		if err != nil {
+			return nil, err
+		}
+		s.token, s.challenge = token, challenge
+	default:
+		return nil, fmt.Errorf("unsupported registry auth scheme %q", challenge.scheme)
+	}
+	return s, nil
+}
+
+// discoverChallenge asks the registry's /v2/ endpoint how to authenticate.
+// An empty scheme means no authentication is needed.
+func (s *registrySession) discoverChallenge(ctx context.Context) (authChallenge, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", s.baseURL, nil)
+	if err != nil {
+		return authChallenge{}, err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return authChallenge{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return parseAuthChallenge(resp.Header.Get("WWW-Authenticate")), nil
+	}
+	if err := classifyResponse(resp, "contact registry"); err != nil {
+		return authChallenge{}, err
+	}
+	return authChallenge{}, nil
+}
+
+func (s *registrySession) fetchToken(ctx context.Context, challenge authChallenge) (string, error) {
+	params := url.Values{}
+	if service := challenge.params["service"]; service != "" {
+		params.Set("service", service)
+	}
+	params.Set("scope", fmt.Sprintf("repository:%s:pull", s.repo))
+	req, err := http.NewRequestWithContext(ctx, "GET", challenge.params["realm"]+"?"+params.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	if s.username != "" {
+		req.SetBasicAuth(s.username, s.password)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if err := classifyResponse(resp, "authenticate"); err != nil {
+		return "", err
+	}
+
+	var tokenResponse TokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResponse); err != nil {
+		return "", err
+	}
+	if tokenResponse.Token == "" {
+		return tokenResponse.AccessToken, nil
+	}
+	return tokenResponse.Token, nil
+}
+
+func (s *registrySession) newRequest(ctx context.Context, method, url string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	token := s.token
+	s.mu.Unlock()
+	switch {
+	case token != "":
+		req.Header.Set("Authorization", "Bearer "+token)
+	case s.basic && s.username != "":
+		req.SetBasicAuth(s.username, s.password)
+	}
+	return req, nil
+}
+
+// do sends req with client. When the registry rejects the bearer token req
+// carries with a 401, it fetches a fresh token for the repository and sends
+// the request once more.
+func (s *registrySession) do(client *http.Client, req *http.Request) (*http.Response, error) {
+	resp, err := client.Do(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	stale, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return resp, nil
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+
+	token, err := s.refreshToken(req.Context(), stale)
+	if err != nil {
+		return nil, err
+	}
+	retry := req.Clone(req.Context())
+	retry.Header.Set("Authorization", "Bearer "+token)
+	return client.Do(retry)
+}
+
+// refreshToken replaces stale with a new token, unless another request
+// already did.
+func (s *registrySession) refreshToken(ctx context.Context, stale string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token != stale {
+		return s.token, nil
+	}
+	logger.Debug("registry token expired, fetching a new one", "repo", s.repo)
+	token, err := s.fetchToken(ctx, s.challenge)
+	if err != nil {
+		return "", err
+	}
+	s.token = token
+	return token, nil
+}
+
+func (s *registrySession) blobURL(digest string) string {
+	return fmt.Sprintf("%s%s/blobs/%s", s.baseURL, s.repo, digest)
+}
+
+const (
+	mediaTypeDockerManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+	mediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+	mediaTypeOCIManifest        = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeOCIIndex           = "application/vnd.oci.image.index.v1+json"
+)
+
+// manifestMediaTypes is everything getManifest accepts, single-image
+// manifests first.
+var manifestMediaTypes = []string{mediaTypeOCIManifest, mediaTypeDockerManifest, mediaTypeOCIIndex, mediaTypeDockerManifestList, mediaTypeDockerManifestV1Signed, mediaTypeDockerManifestV1}
+
+// isTarLayer reports whether a layer of mediaType is a filesystem tarball,
+// compressed or not. Artifacts pushed with oras and similar tools carry
+// plain files as layers instead.
+func isTarLayer(mediaType string) bool {
+	switch {
+	case mediaType == "",
+		strings.HasPrefix(mediaType, "application/vnd.docker.image.rootfs."),
+		strings.HasPrefix(mediaType, "application/vnd.oci.image.layer."):
+		return true
+	}
+	return false
+}
+
+// isForeignLayer reports whether a layer is non-distributable, such as the
+// Windows base layers, which registries may not serve themselves and which
+// the manifest lists external URLs for instead.
+func isForeignLayer(mediaType string) bool {
+	return mediaType == "application/vnd.docker.image.rootfs.foreign.diff.tar.gzip" ||
+		strings.HasPrefix(mediaType, "application/vnd.oci.image.layer.nondistributable.")
+}
+
+func fetchManifest(ctx context.Context, s *registrySession, reference string, accept ...string) ([]byte, error) {
+	if err := waitForPullBudget(ctx, s.baseURL); err != nil {
+		return nil, err
+	}
+	req, err := s.newRequest(ctx, "GET", fmt.Sprintf("%s%s/manifests/%s", s.baseURL, s.repo, reference))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", strings.Join(accept, ", "))
+
+	resp, err := s.do(httpClient, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	recordPullBudget(s.baseURL, resp.Header)
+
+	if err := classifyResponse(resp, "get manifest"); err != nil {
+		return nil, err
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
+func fetchBlob(ctx context.Context, s *registrySession, digest string, limit int64) ([]byte, error) {
+	req, err := s.newRequest(ctx, "GET", s.blobURL(digest))
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.do(httpClient, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if err := classifyResponse(resp, "get blob"); err != nil {
+		return nil, err
+	}
+
+	return io.ReadAll(io.LimitReader(resp.Body, limit))
+}
+
+// verifyManifestDigest makes sure a registry served the exact manifest an
+// image was pinned to.
+func verifyManifestDigest(body []byte, digest string) error {
+	algo, expected, err := splitDigest(digest)
+	if err != nil {
+		return err
+	}
+	hasher, err := newDigestHasher(algo)
+	if err != nil {
+		return err
+	}
+	hasher.Write(body)
+	if actual := hex.EncodeToString(hasher.Sum(nil)); actual != expected {
+		regErr := newRegistryError(ErrDigestMismatch, "get manifest", "got "+algo+":"+actual)
+		regErr.Hint = "the registry served a different manifest than the pinned digest; it, or a proxy in between, cannot be trusted"
+		return regErr
+	}
+	return nil
+}
+
+// getManifest fetches the image manifest for reference. When reference
+// names a multi-platform manifest list, the manifest for platform is
+// fetched from it.
+func getManifest(ctx context.Context, s *registrySession, reference string, platform Platform) (*Manifest, error) {
+	body, err := fetchManifest(ctx, s, reference, manifestMediaTypes...)
+	if err != nil {
+		return nil, err
+	}
+	// Tags cannot contain a colon, so reference is a digest when it has one.
+	if strings.Contains(reference, ":") {
+		if err := verifyManifestDigest(body, reference); err != nil {
+			return nil, err
+		}
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(body, &manifest); err != nil {
+		return nil, err
+	}
+
+	// OCI documents may leave mediaType out; an index is recognized by its
+	// manifests.
+	var index ImageIndex
+	if err := json.Unmarshal(body, &index); err != nil {
+		return nil, err
+	}
+	if len(index.Manifests) > 0 {
+		entry, err := selectPlatform(index, platform)
+		if err != nil {
+			return nil, err
+		}
+		logger.Debug("selected platform from manifest list", "platform", entry.Platform.String(), "digest", entry.Digest)
+		if body, err = fetchManifest(ctx, s, entry.Digest, manifestMediaTypes[:2]...); err != nil {
+			return nil, err
+		}
+		// The index names the digest of each child, so a child is checked
+		// whether or not the index itself was pinned.
+		if err := verifyManifestDigest(body, entry.Digest); err != nil {
+			return nil, err
+		}
+		manifest = Manifest{Platform: entry.Platform}
+		if err := json.Unmarshal(body, &manifest); err != nil {
+			return nil, err
+		}
+	}
+
+	// Legacy repositories may only serve schema 1.
+	var version struct {
+		SchemaVersion int `json:"schemaVersion"`
+	}
+	if json.Unmarshal(body, &version) == nil && version.SchemaVersion == 1 {
+		legacy, err := convertSchema1(body)
+		if err != nil {
+			return nil, newRegistryError(ErrUnsupportedFormat, "get manifest", err.Error())
+		}
+		logger.Info("image uses a legacy schema 1 manifest", "layers", len(legacy.Layers))
+		manifest = *legacy
+	}
+	sum := sha256.Sum256(body)
+	manifest.Digest = "sha256:" + hex.EncodeToString(sum[:])
+
+	if len(manifest.Layers) == 0 {
+		return nil, newRegistryError(ErrUnsupportedFormat, "get manifest", manifest.MediaType)
+	}
+
+	return &manifest, nil
+}
+
+// selectPlatform picks the entry for platform from a manifest list, or
+// fails listing the platforms that are available.
+func selectPlatform(index ImageIndex, platform Platform) (IndexEntry, error) {
+	for _, entry := range index.Manifests {
+		if platform.matches(entry.Platform) {
+			return entry, nil
+		}
+	}
+	var available []string
+	for _, p := range index.platforms() {
+		available = append(available, p.String())
+	}
+	err := newRegistryError(ErrManifestList, "get manifest", "no "+platform.String()+" image")
+	err.Hint = "pick one of the available platforms with --platform: " + strings.Join(available, ", ")
+	return IndexEntry{}, err
+}
+
+// platforms lists the images of the index, leaving out attestation
+// manifests, which are marked unknown/unknown.
+func (index ImageIndex) platforms() []Platform {
+	var platforms []Platform
+	for _, entry := range index.Manifests {
+		if entry.Platform != nil && entry.Platform.OS != "unknown" {
+			platforms = append(platforms, *entry.Platform)
+		}
+	}
+	return platforms
+}
+
+// indexPlatforms returns the platforms ref is published for, or none when
+// it names a single image.
+func indexPlatforms(ctx context.Context, ref imageRef) ([]Platform, error) {
+	session, err := newRegistrySession(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	body, err := fetchManifest(ctx, session, ref.reference(), manifestMediaTypes...)
+	if err != nil {
+		return nil, err
+	}
+	var index ImageIndex
+	if err := json.Unmarshal(body, &index); err != nil {
+		return nil, err
+	}
+	return index.platforms(), nil
+}
+
+type registryTagList struct {
+	Tags []string `json:"tags"`
+}
+
+var nextLinkPattern = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+// listRegistryTags lists tags through the registry API, for registries
+// other than Docker Hub. Registries do not report push dates, so
+// LastUpdated is left empty.
+func listRegistryTags(ctx context.Context, ref imageRef) ([]datedTag, error) {
+	s, err := newRegistrySession(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	var tags []datedTag
+	next := fmt.Sprintf("%s%s/tags/list", s.baseURL, s.repo)
+	for next != "" {
+		req, err := s.newRequest(ctx, "GET", next)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := s.do(httpClient, req)
+		if err != nil {
+			return nil, err
+		}
+		if err := classifyResponse(resp, "list tags"); err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+		var page registryTagList
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range page.Tags {
+			if tagFilter == nil || tagFilter.MatchString(name) {
+				tags = append(tags, datedTag{Name: name})
+			}
+		}
+
+		next = ""
+		if match := nextLinkPattern.FindStringSubmatch(resp.Header.Get("Link")); match != nil {
+			link, err := req.URL.Parse(match[1])
+			if err != nil {
+				return nil, err
+			}
+			next = link.String()
+		}
+	}
+	return tags, nil
+}
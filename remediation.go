@@ -0,0 +1,105 @@
+package main
+
+type Remediation struct {
+	Credential string   `json:"credential"`
+	Steps      []string `json:"steps"`
+	ConsoleURL string   `json:"consoleUrl,omitempty"`
+}
+
+var ruleRemediations = map[string]Remediation{
+	"amazon_mws_auth_token": {
+		Credential: "Amazon MWS auth token",
+		Steps: []string{
+			"Revoke the developer authorization for the leaked token in Seller Central",
+			"Re-authorize the application to issue a new token and update its configuration",
+			"Review MWS/SP-API activity for calls made with the token",
+		},
+		ConsoleURL: "https://sellercentral.amazon.com/apps/manage",
+	},
+	"amazon_aws_url": {
+		Credential: "Amazon S3 bucket reference",
+		Steps: []string{
+			"Confirm the bucket policy and ACLs do not allow public read or write",
+			"Enable S3 Block Public Access if the bucket is not meant to be public",
+			"Check CloudTrail data events for unexpected access to the bucket",
+		},
+		ConsoleURL: "https://s3.console.aws.amazon.com/s3/buckets",
+	},
+	"authorization_bearer": {
+		Credential: "HTTP bearer token",
+		Steps: []string{
+			"Identify the issuing service from the surrounding file",
+			"Revoke the token or rotate the signing secret on the issuing service",
+			"Move the token out of the image into runtime secrets",
+		},
+	},
+	"aws_access_key_id": {
+		Credential: "AWS access key",
+		Steps: []string{
+			"Deactivate and delete the access key in IAM",
+			"Review CloudTrail for calls made with the key",
+			"Give the workload an IAM role instead of long-lived keys",
+		},
+		ConsoleURL: "https://console.aws.amazon.com/iam/home#/security_credentials",
+	},
+	"github_token": {
+		Credential: "GitHub token",
+		Steps: []string{
+			"Revoke the token, or let GitHub secret scanning revoke it by reporting it",
+			"Review the account security log and repository audit log for use of the token",
+			"Pass tokens as build secrets instead of baking them into layers",
+		},
+		ConsoleURL: "https://github.com/settings/tokens",
+	},
+	"github_access_token": {
+		Credential: "GitHub credential embedded in a URL",
+		Steps: []string{
+			"Revoke the personal access token or delete the deploy key",
+			"Review the account security log and repository audit log for use of the token",
+			"Use build secrets instead of credentials in clone URLs",
+		},
+		ConsoleURL: "https://github.com/settings/tokens",
+	},
+	"slack_token": {
+		Credential: "Slack API token",
+		Steps: []string{
+			"Revoke the token from the Slack app configuration",
+			"Reinstall the app to the workspace to issue a new token",
+			"Review workspace access logs for unexpected API use",
+		},
+		ConsoleURL: "https://api.slack.com/apps",
+	},
+	"rsa_private_key":     privateKeyRemediation,
+	"ssh_dsa_private_key": privateKeyRemediation,
+	"ssh_dc_private_key":  privateKeyRemediation,
+	"SSH_privKey":         privateKeyRemediation,
+	"pgp_private_block": {
+		Credential: "PGP private key",
+		Steps: []string{
+			"Publish a revocation certificate for the key to the keyservers you use",
+			"Generate a new key pair and redistribute the public key",
+			"Re-sign or re-encrypt material that depended on the leaked key",
+		},
+	},
+}
+
+var privateKeyRemediation = Remediation{
+	Credential: "Private key",
+	Steps: []string{
+		"Remove the public key from every authorized_keys file, server and service that trusts it",
+		"Revoke any certificate issued for the key",
+		"Generate a new key pair and keep it out of the image build context",
+	},
+}
+
+func remediationsFor(matches map[string]map[string][]string) map[string]Remediation {
+	remediations := make(map[string]Remediation)
+	for _, patterns := range matches {
+		for rule := range patterns {
+			if remediation, ok := ruleRemediations[rule]; ok {
+				remediations[rule] = remediation
+			}
+		}
+	}
+	return remediations
+}
@@ -0,0 +1,436 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+type Report struct {
+	SelectedRepo  string                         `json:"selectedRepo"`
+	SelectedTag   string                         `json:"selectedTag"`
+	Digest        string                         `json:"digest,omitempty"`
+	Platform      string                         `json:"platform,omitempty"`
+	EnvContent    string                         `json:"envContent"`
+	Matches       map[string]map[string][]string `json:"matches"`
+	Exposure      Exposure                       `json:"exposure"`
+	RiskScore     float64                        `json:"riskScore"`
+	Provenance    []Provenance                   `json:"provenance,omitempty"`
+	Remediation   map[string]Remediation         `json:"remediation,omitempty"`
+	Labels        map[string]string              `json:"labels,omitempty"`
+	Config        *ImageConfigSummary            `json:"config,omitempty"`
+	FileMetadata  map[string]FileMeta            `json:"fileMetadata,omitempty"`
+	Access        *RepositoryAccess              `json:"access,omitempty"`
+	Partial       bool                           `json:"partial,omitempty"`
+	PartialReason string                         `json:"partialReason,omitempty"`
+	Composition   *Composition                   `json:"composition,omitempty"`
+	FileTypes     *FileTypeStats                 `json:"fileTypes,omitempty"`
+	ScannedAt     time.Time                      `json:"scannedAt"`
+	Canaries      []CanaryFinding                `json:"canaries,omitempty"`
+	LowConfidence []LowConfidenceMatch           `json:"lowConfidence,omitempty"`
+	Nested        []NestedArtifact               `json:"nested,omitempty"`
+	SameContent   []string                       `json:"sameContent,omitempty"`
+	SkippedLayers []string                       `json:"skippedLayers,omitempty"`
+	Suppressed    []SuppressedMatch              `json:"suppressed,omitempty"`
+	PullBudget    *PullBudget                    `json:"pullBudget,omitempty"`
+	Contacts      []DisclosureContact            `json:"disclosureContacts,omitempty"`
+	Verification  map[string]string              `json:"layerVerification,omitempty"`
+	Inputs        *ScanInputs                    `json:"inputs,omitempty"`
+}
+
+type Exposure struct {
+	PullCount int64   `json:"pullCount"`
+	StarCount int     `json:"starCount"`
+	IsPrivate bool    `json:"isPrivate"`
+	Level     string  `json:"level"`
+	Weight    float64 `json:"weight"`
+}
+
+// Exposure weight grows with the order of magnitude of pulls and stars, so a
+// leak in an image pulled millions of times outranks one in an obscure repo.
+// Private repositories are only reachable by their collaborators.
+func computeExposure(info *RepositoryInfo) Exposure {
+	if info == nil {
+		return Exposure{Level: "unknown", Weight: 1}
+	}
+
+	exposure := Exposure{
+		PullCount: info.PullCount,
+		StarCount: info.StarCount,
+		IsPrivate: info.IsPrivate,
+		Weight:    1,
+	}
+	if info.IsPrivate {
+		exposure.Level = "private"
+		return exposure
+	}
+
+	exposure.Weight += math.Log10(float64(info.PullCount)+1) + math.Log10(float64(info.StarCount)+1)/2
+	exposure.Weight = math.Round(exposure.Weight*100) / 100
+
+	switch {
+	case info.PullCount >= 1000000:
+		exposure.Level = "critical"
+	case info.PullCount >= 10000:
+		exposure.Level = "high"
+	case info.PullCount >= 100:
+		exposure.Level = "medium"
+	default:
+		exposure.Level = "low"
+	}
+	return exposure
+}
+
+func riskScore(matches map[string]map[string][]string, exposure Exposure) float64 {
+	findings := 0
+	for _, patterns := range matches {
+		for _, matched := range patterns {
+			findings += len(matched)
+		}
+	}
+	return math.Round(float64(findings)*exposure.Weight*100) / 100
+}
+
+type FileMeta struct {
+	ModTime  time.Time `json:"modTime"`
+	UID      int       `json:"uid"`
+	GID      int       `json:"gid"`
+	Uname    string    `json:"uname,omitempty"`
+	Gname    string    `json:"gname,omitempty"`
+	Mode     string    `json:"mode"`
+	Layer    string    `json:"layer,omitempty"`
+	Encoding string    `json:"encoding,omitempty"`
+	Size     int64     `json:"size"`
+	Digest   string    `json:"digest,omitempty"`
+}
+
+func fileMetaFromHeader(header *tar.Header) FileMeta {
+	return FileMeta{
+		ModTime: header.ModTime.UTC(),
+		UID:     header.Uid,
+		GID:     header.Gid,
+		Uname:   header.Uname,
+		Gname:   header.Gname,
+		Mode:    header.FileInfo().Mode().String(),
+		Size:    header.Size,
+	}
+}
+
+var severityRank = map[string]int{
+	"low":      1,
+	"medium":   2,
+	"high":     3,
+	"critical": 4,
+}
+
+var ruleSeverities = map[string]string{
+	"amazon_aws_url":        "low",
+	"authorization_bearer":  "medium",
+	"amazon_mws_auth_token": "high",
+	"aws_access_key_id":     "high",
+	"github_token":          "high",
+	"github_access_token":   "high",
+	"slack_token":           "high",
+	"rsa_private_key":       "critical",
+	"ssh_dsa_private_key":   "critical",
+	"ssh_dc_private_key":    "critical",
+	"pgp_private_block":     "critical",
+	"SSH_privKey":           "critical",
+	"sensitive_filename":    "high",
+	"canarytoken_url":       "low",
+}
+
+func ruleSeverity(rule string) string {
+	if severity, ok := ruleSeverities[rule]; ok {
+		return severity
+	}
+	return "medium"
+}
+
+func meetsSeverity(rule, minSeverity string) bool {
+	if minSeverity == "" {
+		return true
+	}
+	return severityRank[ruleSeverity(rule)] >= severityRank[minSeverity]
+}
+
+func (r *Report) filterSeverity(minSeverity string) *Report {
+	if minSeverity == "" {
+		return r
+	}
+
+	filtered := *r
+	filtered.Matches = make(map[string]map[string][]string)
+	for path, patterns := range r.Matches {
+		for rule, matched := range patterns {
+			if !meetsSeverity(rule, minSeverity) {
+				continue
+			}
+			if filtered.Matches[path] == nil {
+				filtered.Matches[path] = make(map[string][]string)
+			}
+			filtered.Matches[path][rule] = matched
+		}
+	}
+	filtered.Remediation = remediationsFor(filtered.Matches)
+	return &filtered
+}
+
+func (r *Report) findingCount() int {
+	count := 0
+	for _, patterns := range r.Matches {
+		for _, matched := range patterns {
+			count += len(matched)
+		}
+	}
+	return count
+}
+
+func formatReport(report *Report, format string) ([]byte, error) {
+	switch format {
+	case "", "json":
+		return json.Marshal(report)
+	case "text":
+		return formatReportText(report), nil
+	default:
+		return nil, fmt.Errorf("unknown report format: %s", format)
+	}
+}
+
+func formatReports(reports []*Report, format string) ([]byte, error) {
+	if len(reports) == 1 {
+		return formatReport(reports[0], format)
+	}
+
+	switch format {
+	case "", "json":
+		return json.Marshal(reports)
+	case "text":
+		var buf bytes.Buffer
+		for i, report := range reports {
+			if i > 0 {
+				buf.WriteString("\n")
+			}
+			buf.Write(formatReportText(report))
+		}
+		return buf.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("unknown report format: %s", format)
+	}
+}
+
+func filterReports(reports []*Report, minSeverity string) []*Report {
+	filtered := make([]*Report, len(reports))
+	for i, report := range reports {
+		filtered[i] = report.filterSeverity(minSeverity)
+	}
+	return filtered
+}
+
+func decodeReports(data []byte) ([]*Report, error) {
+	var reports []*Report
+	if err := json.Unmarshal(data, &reports); err == nil {
+		return reports, nil
+	}
+
+	var report Report
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, err
+	}
+	return []*Report{&report}, nil
+}
+
+func (r *Report) mismatchedLayers() []string {
+	var digests []string
+	for digest, status := range r.Verification {
+		if status == layerMismatch {
+			digests = append(digests, digest)
+		}
+	}
+	sort.Strings(digests)
+	return digests
+}
+
+func formatReportText(report *Report) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, tr("DockerSpy report for %s\n"), reportImage(report))
+	if report.Platform != "" {
+		fmt.Fprintf(&buf, tr("Platform: %s\n"), report.Platform)
+	}
+	fmt.Fprintf(&buf, tr("Exposure: %s (pulls: %d, stars: %d, private: %t)\n"), tr(report.Exposure.Level), report.Exposure.PullCount, report.Exposure.StarCount, report.Exposure.IsPrivate)
+	fmt.Fprintf(&buf, tr("Risk score: %.2f\n"), report.RiskScore)
+	fmt.Fprintf(&buf, tr("Findings: %d\n"), report.findingCount())
+	if report.Partial {
+		fmt.Fprintf(&buf, tr("Partial result: %s\n"), tr(report.PartialReason))
+	}
+	if mismatched := report.mismatchedLayers(); len(mismatched) > 0 {
+		fmt.Fprintf(&buf, tr("Layers failing digest verification, not scanned: %s\n"), strings.Join(mismatched, ", "))
+	}
+	if b := report.PullBudget; b != nil {
+		fmt.Fprintf(&buf, tr("Pull budget: %d of %d left (%s window)\n"), b.Remaining, b.Limit, b.Window)
+	}
+	if len(report.SameContent) > 0 {
+		fmt.Fprintf(&buf, tr("Same content as: %s\n"), strings.Join(report.SameContent, ", "))
+	}
+	if in := report.Inputs; in != nil {
+		fmt.Fprintf(&buf, tr("Scanned with dockerspy %s, rules %s, manifest %s\n"), in.ToolVersion, in.RulesDigest, in.ManifestDigest)
+	}
+
+	if len(report.Labels) > 0 {
+		fmt.Fprintf(&buf, tr("\nLabels\n"))
+		keys := make([]string, 0, len(report.Labels))
+		for key := range report.Labels {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Fprintf(&buf, "  %s: %s\n", key, report.Labels[key])
+		}
+	}
+
+	if c := report.Config; c != nil {
+		fmt.Fprintf(&buf, tr("\nImage config\n"))
+		if c.User != "" {
+			fmt.Fprintf(&buf, tr("  user: %s\n"), c.User)
+		}
+		if len(c.Entrypoint) > 0 {
+			fmt.Fprintf(&buf, tr("  entrypoint: %s\n"), strings.Join(c.Entrypoint, " "))
+		}
+		if len(c.Cmd) > 0 {
+			fmt.Fprintf(&buf, tr("  command: %s\n"), strings.Join(c.Cmd, " "))
+		}
+		if len(c.ExposedPorts) > 0 {
+			fmt.Fprintf(&buf, tr("  exposed ports: %s\n"), strings.Join(c.ExposedPorts, ", "))
+		}
+		fmt.Fprintf(&buf, tr("  %d environment variables, %d build steps\n"), len(c.Env), len(c.History))
+		if c.Dockerfile != "" {
+			fmt.Fprintf(&buf, tr("\nReconstructed Dockerfile\n"))
+			for _, line := range strings.Split(strings.TrimSuffix(c.Dockerfile, "\n"), "\n") {
+				fmt.Fprintf(&buf, "  %s\n", line)
+			}
+		}
+	}
+
+	if report.Access != nil {
+		fmt.Fprintf(&buf, tr("\nAccess\n"))
+		for _, team := range report.Access.Teams {
+			fmt.Fprintf(&buf, tr("  team %s (%s): %s\n"), team.Team, team.Permission, strings.Join(team.Members, ", "))
+		}
+		if len(report.Access.Collaborators) > 0 {
+			fmt.Fprintf(&buf, tr("  collaborators: %s\n"), strings.Join(report.Access.Collaborators, ", "))
+		}
+	}
+
+	paths := make([]string, 0, len(report.Matches))
+	for path := range report.Matches {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		fmt.Fprintf(&buf, "\n%s\n", path)
+		if meta, ok := report.FileMetadata[path]; ok {
+			fmt.Fprintf(&buf, tr("  %s %s:%s (%d:%d) modified %s\n"), meta.Mode, meta.Uname, meta.Gname, meta.UID, meta.GID, meta.ModTime.Format(time.RFC3339))
+		}
+		for rule, matched := range report.Matches[path] {
+			fmt.Fprintf(&buf, tr("  [%s] %s: %d match(es)\n"), tr(ruleSeverity(rule)), rule, len(matched))
+		}
+		for _, canary := range report.Canaries {
+			if canary.Path == path {
+				fmt.Fprintf(&buf, tr("  [canary] %s: %s, do not use\n"), canary.Rule, canary.Reason)
+			}
+		}
+		for _, low := range report.LowConfidence {
+			if low.Path == path {
+				fmt.Fprintf(&buf, tr("  [low confidence] %s: %s\n"), low.Rule, low.Reason)
+			}
+		}
+	}
+
+	if len(report.Suppressed) > 0 {
+		fmt.Fprintf(&buf, tr("\nPlaceholder values suppressed: %d\n"), len(report.Suppressed))
+	}
+	if len(report.SkippedLayers) > 0 {
+		fmt.Fprintf(&buf, tr("\nForeign layers not scanned: %s\n"), strings.Join(report.SkippedLayers, ", "))
+	}
+
+	if len(report.Contacts) > 0 {
+		fmt.Fprintf(&buf, tr("\nDisclosure contacts\n"))
+	}
+	for _, contact := range report.Contacts {
+		fmt.Fprintf(&buf, "  %s: %s (%s)\n", contact.Kind, contact.Value, contact.Source)
+	}
+
+	if len(report.Nested) > 0 {
+		fmt.Fprintf(&buf, tr("\nEmbedded artifacts\n"))
+	}
+	for _, artifact := range report.Nested {
+		status := tr("not scanned")
+		if artifact.Scanned {
+			status = tr("scanned")
+		}
+		fmt.Fprintf(&buf, tr("  %s: %s, %s, %s (layer %s)\n"), artifact.Path, artifact.Kind, formatBytes(artifact.Size), status, artifact.Layer)
+	}
+
+	if c := report.Composition; c != nil {
+		fmt.Fprintf(&buf, tr("\nComposition\n"))
+		fmt.Fprintf(&buf, tr("  %d files, %s compressed, %s uncompressed, %s duplicated\n"), c.FileCount, formatBytes(c.CompressedSize), formatBytes(c.UncompressedSize), formatBytes(c.WastedBytes))
+		for _, layer := range c.Layers {
+			fmt.Fprintf(&buf, tr("  layer %s: %s compressed, %s uncompressed, %d files\n"), layer.Digest, formatBytes(layer.CompressedSize), formatBytes(layer.UncompressedSize), layer.FileCount)
+		}
+		if len(c.LargestFiles) > 0 {
+			fmt.Fprintf(&buf, tr("  largest files:\n"))
+		}
+		for _, file := range c.LargestFiles {
+			fmt.Fprintf(&buf, "    %10s  %s\n", formatBytes(file.Size), file.Path)
+		}
+		if len(c.Duplicates) > 0 {
+			fmt.Fprintf(&buf, tr("  duplicate files:\n"))
+		}
+		for _, dup := range c.Duplicates {
+			fmt.Fprintf(&buf, tr("    %10s wasted, %d copies of %s\n"), formatBytes(dup.WastedBytes), len(dup.Copies), dup.Copies[0].Path)
+			for _, file := range dup.Copies[1:] {
+				fmt.Fprintf(&buf, tr("      also %s (layer %s)\n"), file.Path, file.Layer)
+			}
+		}
+	}
+
+	if s := report.FileTypes; s != nil && len(s.Types) > 0 {
+		fmt.Fprintf(&buf, tr("\nFile types\n"))
+		fmt.Fprintf(&buf, tr("  %s spent scanning file contents\n"), s.ScanTime.Round(time.Millisecond))
+		for _, stat := range s.Types {
+			fmt.Fprintf(&buf, tr("  %-10s %6d files %10s %10s %5d match(es)"), stat.Extension, stat.Files, formatBytes(stat.Bytes), stat.ScanTime.Round(time.Millisecond), stat.Matches)
+			if stat.Skipped > 0 {
+				fmt.Fprintf(&buf, tr(", %d skipped"), stat.Skipped)
+			}
+			fmt.Fprintf(&buf, "\n")
+		}
+		if suggested := append(append([]string{}, s.SuggestedIgnore...), s.SuggestedIgnorePaths...); len(suggested) > 0 {
+			fmt.Fprintf(&buf, tr("  consider adding to ignore_extensions.json: %s\n"), strings.Join(suggested, ", "))
+		}
+	}
+
+	rules := make([]string, 0, len(report.Remediation))
+	for rule := range report.Remediation {
+		rules = append(rules, rule)
+	}
+	sort.Strings(rules)
+	if len(rules) > 0 {
+		fmt.Fprintf(&buf, tr("\nRemediation\n"))
+	}
+	for _, rule := range rules {
+		remediation := report.Remediation[rule]
+		fmt.Fprintf(&buf, "\n%s (%s)\n", remediation.Credential, rule)
+		for i, step := range remediation.Steps {
+			fmt.Fprintf(&buf, "  %d. %s\n", i+1, step)
+		}
+		if remediation.ConsoleURL != "" {
+			fmt.Fprintf(&buf, tr("  Console: %s\n"), remediation.ConsoleURL)
+		}
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// retentionPolicy says how long stored data is kept before purge removes it.
+// Findings are the file index and undelivered reports, evidence the cached
+// layers, cache the Docker Hub responses.
+type retentionPolicy struct {
+	Findings string `yaml:"findings" json:"findings"`
+	Evidence string `yaml:"evidence" json:"evidence"`
+	Cache    string `yaml:"cache" json:"cache"`
+}
+
+var defaultRetention = retentionPolicy{Findings: "180d", Evidence: "30d", Cache: "7d"}
+
+// retentionAge is a flag value accepting Go durations and whole days, such as
+// 180d. 0 keeps data forever.
+type retentionAge time.Duration
+
+func (a *retentionAge) Set(value string) error {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid number of days %q", value)
+		}
+		*a = retentionAge(time.Duration(n) * 24 * time.Hour)
+		return nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return fmt.Errorf("invalid retention %q, use a duration such as 720h or 30d", value)
+	}
+	*a = retentionAge(d)
+	return nil
+}
+
+func (a *retentionAge) String() string {
+	d := time.Duration(*a)
+	if d%(24*time.Hour) == 0 {
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	}
+	return d.String()
+}
+
+func (a *retentionAge) Type() string { return "age" }
+
+// purgeTarget is a store whose entries are removed once their modification
+// time is older than its retention. Cached layers are touched on every use,
+// so only layers no scan needed for that long go.
+type purgeTarget struct {
+	category string
+	dir      string
+	keep     time.Duration
+}
+
+type purgeResult struct {
+	removed int
+	bytes   int64
+}
+
+func purgeTargets(findings, evidence, cache time.Duration) []purgeTarget {
+	return []purgeTarget{
+		{"findings", defaultIndexDir(), findings},
+		{"findings", deadLetterDir(), findings},
+		{"evidence", defaultBlobCacheDir(), evidence},
+		{"cache", filepath.Dir(hubCachePath("")), cache},
+	}
+}
+
+// purge removes the entries of target older than its retention, or only
+// counts them when dryRun is set.
+func purge(target purgeTarget, now time.Time, dryRun bool) (purgeResult, error) {
+	var result purgeResult
+	if target.keep <= 0 || target.dir == "" {
+		return result, nil
+	}
+	entries, err := os.ReadDir(target.dir)
+	if os.IsNotExist(err) {
+		return result, nil
+	}
+	if err != nil {
+		return result, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || now.Sub(info.ModTime()) < target.keep {
+			continue
+		}
+		path := filepath.Join(target.dir, entry.Name())
+		if dryRun {
+			logger.Info("would purge", "category", target.category, "path", path, "age", now.Sub(info.ModTime()).Round(time.Hour))
+		} else if err := os.Remove(path); err != nil {
+			logger.Warn("could not purge", "path", path, "error", err)
+			continue
+		}
+		result.removed++
+		result.bytes += info.Size()
+	}
+	return result, nil
+}
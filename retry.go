@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const (
+	maxRetryDelay = 30 * time.Second
+	// maxRetryAfter is the longest Retry-After a rate limited request waits
+	// out; a longer one fails the request with the wait in its error.
+	maxRetryAfter = 15 * time.Minute
+	// defaultRateLimitWait applies when a 429 response says nothing about
+	// when to come back.
+	defaultRateLimitWait = time.Minute
+	// maxRateLimitWaits is how many 429 responses one request waits out
+	// before failing, independent of the retry policy.
+	maxRateLimitWaits = 5
+)
+
+// retryPolicy decides how often and how long to wait before repeating a
+// request that failed for a reason likely to go away on its own.
+type retryPolicy struct {
+	attempts int
+	backoff  time.Duration
+	jitter   float64
+}
+
+var defaultRetryPolicy = retryPolicy{attempts: 3, backoff: time.Second, jitter: 0.5}
+
+// registryRetry is the policy in use, set with --retries, --retry-backoff and
+// --retry-jitter. Layer downloads consult it directly to resume after a
+// connection drops mid-transfer.
+var registryRetry = defaultRetryPolicy
+
+// delay doubles the backoff with each attempt and spreads it by up to
+// jitter in either direction, so parallel scans do not retry in lockstep.
+func (p retryPolicy) delay(attempt int) time.Duration {
+	delay := p.backoff << attempt
+	if delay > maxRetryDelay || delay <= 0 {
+		delay = maxRetryDelay
+	}
+	if p.jitter > 0 {
+		delay = time.Duration(float64(delay) * (1 + p.jitter*(2*rand.Float64()-1)))
+	}
+	return delay
+}
+
+func (p retryPolicy) sleep(ctx context.Context, attempt int) error {
+	return sleepContext(ctx, p.delay(attempt))
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// transientError reports whether err is a dropped connection or a network
+// timeout. Certificate and protocol errors will fail the same way again.
+func transientError(err error) bool {
+	var netErr net.Error
+	var dnsErr *net.DNSError
+	switch {
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.ECONNREFUSED), errors.Is(err, syscall.EPIPE),
+		errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, io.EOF), errors.Is(err, errDownloadStalled):
+		return true
+	case errors.As(err, &dnsErr):
+		return dnsErr.IsTemporary || dnsErr.IsTimeout
+	case errors.As(err, &netErr):
+		return netErr.Timeout()
+	}
+	return false
+}
+
+// retryAfter reads the Retry-After header, in seconds or as an HTTP date.
+func retryAfter(header http.Header) (time.Duration, bool) {
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0), true
+	}
+	return 0, false
+}
+
+func transientStatus(code int) bool {
+	switch code {
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryTransport repeats GET and HEAD requests, which are safe to send
+// again, after transient network errors and 5xx responses, and waits out
+// 429 responses for as long as Retry-After asks. Token, manifest,
+// blob and Hub requests all go through it.
+type retryTransport struct {
+	base   http.RoundTripper
+	policy retryPolicy
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return t.base.RoundTrip(req)
+	}
+	// 429 waits have their own cap, so --retries 0 still honours
+	// Retry-After and waiting does not use up the retries for failures.
+	attempt, waits := 0, 0
+	for {
+		resp, err := t.base.RoundTrip(req)
+		if req.Context().Err() != nil {
+			return resp, err
+		}
+		switch {
+		case err == nil && resp.StatusCode == http.StatusTooManyRequests:
+			wait, ok := retryAfter(resp.Header)
+			if !ok {
+				wait = defaultRateLimitWait
+			}
+			if wait > maxRetryAfter || waits >= maxRateLimitWaits {
+				return resp, nil
+			}
+			logger.Warn("rate limited by the registry, pausing", "host", req.URL.Host, "retryIn", wait.Round(time.Second),
+				"limit", resp.Header.Get("RateLimit-Limit"), "remaining", resp.Header.Get("RateLimit-Remaining"))
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+			if err := sleepContext(req.Context(), wait); err != nil {
+				return nil, err
+			}
+			waits++
+			continue
+		case attempt >= t.policy.attempts:
+			return resp, err
+		case err != nil && transientError(err):
+			logger.Debug("request failed, retrying", "url", req.URL.Redacted(), "attempt", attempt+1, "error", err)
+		case err == nil && transientStatus(resp.StatusCode):
+			logger.Debug("registry error, retrying", "url", req.URL.Redacted(), "attempt", attempt+1, "status", resp.Status)
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+		default:
+			return resp, err
+		}
+		if err := t.policy.sleep(req.Context(), attempt); err != nil {
+			return nil, err
+		}
+		attempt++
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+type reviewFinding struct {
+	image       string
+	path        string
+	rule        string
+	match       string
+	disposition string
+}
+
+func collectFindings(reports []*Report) []*reviewFinding {
+	var findings []*reviewFinding
+	for _, report := range reports {
+		paths := make([]string, 0, len(report.Matches))
+		for path := range report.Matches {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		for _, path := range paths {
+			rules := make([]string, 0, len(report.Matches[path]))
+			for rule := range report.Matches[path] {
+				rules = append(rules, rule)
+			}
+			sort.Strings(rules)
+			for _, rule := range rules {
+				for _, match := range report.Matches[path][rule] {
+					findings = append(findings, &reviewFinding{
+						image: reportImage(report),
+						path:  path,
+						rule:  rule,
+						match: match,
+					})
+				}
+			}
+		}
+	}
+	return findings
+}
+
+type reviewModel struct {
+	findings []*reviewFinding
+	cursor   int
+	aborted  bool
+}
+
+func (m reviewModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m reviewModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	key, ok := msg.(tea.KeyMsg)
+	if !ok {
+		return m, nil
+	}
+
+	switch key.String() {
+	case "ctrl+c":
+		m.aborted = true
+		return m, tea.Quit
+	case "q":
+		return m, tea.Quit
+	case "f", "c", "u":
+		dispositions := map[string]string{"f": "false_positive", "c": "confirmed", "u": ""}
+		m.findings[m.cursor].disposition = dispositions[key.String()]
+		if m.cursor < len(m.findings)-1 {
+			m.cursor++
+		}
+	case "n", "right", "down", "j":
+		if m.cursor < len(m.findings)-1 {
+			m.cursor++
+		}
+	case "p", "left", "up", "k":
+		if m.cursor > 0 {
+			m.cursor--
+		}
+	}
+	return m, nil
+}
+
+func (m reviewModel) View() string {
+	finding := m.findings[m.cursor]
+	status := finding.disposition
+	if status == "" {
+		status = "unreviewed"
+	}
+
+	reviewed := 0
+	for _, f := range m.findings {
+		if f.disposition != "" {
+			reviewed++
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Finding %d of %d (%d reviewed)\n\n", m.cursor+1, len(m.findings), reviewed)
+	fmt.Fprintf(&b, "  image:    %s\n", finding.image)
+	fmt.Fprintf(&b, "  file:     %s\n", finding.path)
+	fmt.Fprintf(&b, "  rule:     %s [%s]\n", finding.rule, ruleSeverity(finding.rule))
+	fmt.Fprintf(&b, "  match:    %s\n", finding.match)
+	fmt.Fprintf(&b, "  status:   %s\n\n", status)
+	b.WriteString("f false positive • c confirmed • u clear • n/→ next • p/← previous • q save and quit\n")
+	return b.String()
+}
+
+// reviewFindings steps through every finding in reports and appends the
+// decisions to the allowlist (false positives) and baseline (confirmed).
+func reviewFindings(reports []*Report) error {
+	findings := collectFindings(reports)
+	if len(findings) == 0 {
+		logger.Info("no findings to review")
+		return nil
+	}
+
+	final, err := tea.NewProgram(reviewModel{findings: findings}, tea.WithAltScreen()).Run()
+	if err != nil {
+		return err
+	}
+	if final.(reviewModel).aborted {
+		logger.Info("review aborted, nothing saved")
+		return nil
+	}
+
+	allowlistPath := dispositionFile(settings.Allowlist, "allowlist.json")
+	allowlist, err := loadAllowlist(allowlistPath)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", allowlistPath, err)
+	}
+	baselinePath := dispositionFile(settings.Baseline, "baseline.json")
+	var baseline []BaselineEntry
+	if err := loadJSONList(baselinePath, &baseline); err != nil {
+		return fmt.Errorf("failed to read %s: %v", baselinePath, err)
+	}
+
+	var falsePositives, confirmed int
+	for _, finding := range findings {
+		switch finding.disposition {
+		case "false_positive":
+			entry := AllowlistEntry{Rule: finding.rule, Match: finding.match, Reason: "marked false positive in review of " + finding.image}
+			known := false
+			for _, existing := range allowlist {
+				if existing.Rule == entry.Rule && existing.Match == entry.Match && existing.Path == "" {
+					known = true
+					break
+				}
+			}
+			if !known {
+				allowlist = append(allowlist, entry)
+				falsePositives++
+			}
+		case "confirmed":
+			baseline = append(baseline, BaselineEntry{
+				Image:     finding.image,
+				Path:      finding.path,
+				Rule:      finding.rule,
+				Match:     finding.match,
+				Confirmed: time.Now().UTC(),
+			})
+			confirmed++
+		}
+	}
+
+	if falsePositives > 0 {
+		if err := saveJSONList(allowlistPath, allowlist); err != nil {
+			return err
+		}
+		logger.Info("allowlist updated", "file", allowlistPath, "added", falsePositives)
+	}
+	if confirmed > 0 {
+		if err := saveJSONList(baselinePath, baseline); err != nil {
+			return err
+		}
+		logger.Info("baseline updated", "file", baselinePath, "added", confirmed)
+	}
+	return nil
+}
@@ -0,0 +1,802 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type scanConfig struct {
+	regexPatterns    map[string]Matcher
+	ignoreExtensions []string
+	sinks            []Sink
+	blobs            BlobStore
+	outputDir        string
+	maxDuration      time.Duration
+	hubJWT           string
+	failOn           string
+	dryRun           bool
+	allowlist        []AllowlistEntry
+	placeholders     placeholderSet
+	profile          scanProfile
+	layers           *layerCache
+	allTags          bool
+	indexDir         string
+	latest           int
+	keepArtifacts    bool
+	scanNested       bool
+	rulesDigest      string
+	journal          *scanJournal
+}
+
+// scanImage scans ref and records its start and outcome in the journal.
+func scanImage(ctx context.Context, cfg *scanConfig, ref imageRef) (*Report, error) {
+	image := ref.label()
+	started := time.Now()
+	cfg.journal.record(journalEvent{Event: journalScanStarted, Image: image})
+	report, err := scanImageLayers(ctx, cfg, ref)
+	duration := time.Since(started).Round(time.Millisecond).String()
+	if err != nil {
+		cfg.journal.record(journalEvent{Event: journalScanFailed, Image: image, Duration: duration, Error: err.Error()})
+		return nil, err
+	}
+	cfg.journal.record(journalEvent{Event: journalScanCompleted, Image: image, Findings: report.findingCount(), Partial: report.PartialReason, Duration: duration})
+	return report, nil
+}
+
+func scanImageLayers(parent context.Context, cfg *scanConfig, ref imageRef) (*Report, error) {
+	ctx := parent
+	if cfg.maxDuration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.maxDuration)
+		defer cancel()
+	}
+
+	image := ref.String()
+	var repoInfo *RepositoryInfo
+	var err error
+	if ref.isDockerHub() {
+		repoInfo, err = getRepositoryInfo(ref.Repo)
+		if err != nil {
+			logger.Warn("could not fetch repository popularity", "repo", ref.Repo, "error", err, "hint", errorHint(err))
+		}
+	}
+	exposure := computeExposure(repoInfo)
+	logger.Info("exposure", "repo", ref.name(), "level", exposure.Level, "pulls", exposure.PullCount, "stars", exposure.StarCount, "private", exposure.IsPrivate)
+
+	var access *RepositoryAccess
+	if cfg.hubJWT != "" && ref.isDockerHub() {
+		access = getRepositoryAccess(ref.Repo, cfg.hubJWT)
+		for _, team := range access.Teams {
+			logger.Info("team access", "team", team.Team, "permission", team.Permission, "members", strings.Join(team.Members, ","))
+		}
+		if len(access.Collaborators) > 0 {
+			logger.Info("collaborators", "users", strings.Join(access.Collaborators, ","))
+		}
+	}
+
+	session, err := newRegistrySession(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, err := getManifest(ctx, session, ref.reference(), ref.platform())
+	if err != nil {
+		return nil, err
+	}
+	budget := pullBudgetFor(session.baseURL)
+	if budget != nil {
+		logger.Info("pull budget", "remaining", budget.Remaining, "limit", budget.Limit, "window", budget.Window)
+	}
+
+	provenance, err := getProvenance(ctx, session, ref.reference())
+	if err != nil {
+		logger.Warn("could not read provenance attestations", "error", err)
+	}
+	for _, p := range provenance {
+		logger.Info("provenance", "predicateType", p.PredicateType, "builder", p.BuilderID, "source", p.SourceRepo, "revision", p.SourceRevision)
+	}
+
+	var labels map[string]string
+	var configSummary *ImageConfigSummary
+	var contacts []DisclosureContact
+	imageConfig, err := getImageConfig(ctx, session, manifest)
+	if err != nil {
+		logger.Warn("could not read image config", "error", err)
+	} else {
+		labels = imageConfig.labels()
+		configSummary = imageConfig.summary()
+		contacts = append(labelContacts(labels), historyContacts(imageConfig.History)...)
+		for _, key := range attributionLabels {
+			if value, ok := labels[key]; ok {
+				logger.Info("label", "key", key, "value", value)
+			}
+		}
+	}
+
+	dirName := image
+	if ref.Platform != nil {
+		dirName += "_" + ref.Platform.String()
+	}
+	imageDir := filepath.Join(cfg.outputDir, strings.NewReplacer("/", "_", ":", "_", "@", "_").Replace(dirName))
+	if err := removeDir(imageDir); err != nil {
+		return nil, fmt.Errorf("failed to clean %s: %v", imageDir, err)
+	}
+	os.MkdirAll(imageDir, os.ModePerm)
+	if !cfg.keepArtifacts {
+		defer removeDir(imageDir)
+	}
+
+	var envContent string
+	matchesResult := scanLabels(labels, cfg.regexPatterns)
+	if cfg.profile.ConfigEnv && imageConfig != nil {
+		for source, matches := range scanImageConfig(imageConfig, cfg.regexPatterns) {
+			matchesResult[source] = matches
+		}
+	}
+	for source, matches := range matchesResult {
+		logMatches(source, matches)
+	}
+
+	fileMetadata := make(map[string]FileMeta)
+	var nested []NestedArtifact
+	var skippedLayers []string
+	verification := make(map[string]string)
+	composition := newComposition()
+	fileTypes := newFileTypeStats()
+	indexed := &IndexedImage{Image: image, Scanned: time.Now().UTC(), Layers: layerDigests(manifest.Layers)}
+	partial := false
+	bars := progress.startImage(image, manifest.Layers)
+	defer progress.finishImage(bars)
+	for i, layer := range manifest.Layers {
+		if ctx.Err() != nil {
+			partial = true
+			break
+		}
+
+		bar := bars.layers[i]
+		_, hexDigest, err := splitDigest(layer.Digest)
+		if err != nil {
+			logger.Warn("invalid digest format", "digest", layer.Digest)
+			progress.setStatus(bar, "skipped")
+			continue
+		}
+		extractedDir := filepath.Join(imageDir, hexDigest)
+		result, cached := cfg.layers.get(layer.Digest)
+		if cached {
+			logger.Info("layer already scanned, reusing results", "digest", layer.Digest)
+			progress.setStatus(bar, "cached")
+			verification[layer.Digest] = layerVerified
+			cfg.journal.record(journalEvent{Event: journalLayerFetched, Image: image, Layer: layer.Digest, Size: layer.Size, Cached: true})
+		} else {
+			logger.Info("downloading layer", "digest", layer.Digest, "size", layer.Size)
+			outputPath, err := cfg.blobs.Fetch(withLayerBar(ctx, bar), session, layer)
+			if isErrorKind(err, ErrDigestMismatch) && ctx.Err() == nil {
+				logger.Warn("layer does not match its digest, downloading it again", "digest", layer.Digest)
+				outputPath, err = cfg.blobs.Fetch(withLayerBar(ctx, bar), session, layer)
+			}
+			if err != nil {
+				if ctx.Err() != nil {
+					partial = true
+					break
+				}
+				cfg.journal.record(journalEvent{Event: journalLayerFailed, Image: image, Layer: layer.Digest, Error: err.Error()})
+				if isErrorKind(err, ErrDigestMismatch) {
+					logger.Error("layer does not match its digest, not scanning it", "digest", layer.Digest, "error", err)
+					progress.setStatus(bar, "failed")
+					verification[layer.Digest] = layerMismatch
+					continue
+				}
+				if isForeignLayer(layer.MediaType) {
+					logger.Warn("skipping foreign layer that could not be downloaded", "digest", layer.Digest, "urls", strings.Join(layer.URLs, ","), "error", err)
+					progress.setStatus(bar, "skipped")
+					skippedLayers = append(skippedLayers, layer.Digest)
+					continue
+				}
+				return nil, err
+			}
+
+			verification[layer.Digest] = layerVerified
+			cfg.journal.record(journalEvent{Event: journalLayerFetched, Image: image, Layer: layer.Digest, Size: layer.Size})
+
+			logger.Debug("extracting layer", "blob", outputPath, "dir", extractedDir)
+			progress.setStatus(bar, "extracting")
+			result, err = scanLayer(ctx, cfg, outputPath, layer, extractedDir, bar)
+			if !cfg.keepArtifacts {
+				if err := removeDir(extractedDir); err != nil {
+					logger.Warn("could not remove extracted layer", "dir", extractedDir, "error", err)
+				}
+				removeDir(extractedDir + ".nested")
+			}
+			if err != nil {
+				if ctx.Err() != nil {
+					partial = true
+					break
+				}
+				logger.Error("error extracting layer", "digest", layer.Digest, "error", err)
+				cfg.journal.record(journalEvent{Event: journalLayerFailed, Image: image, Layer: layer.Digest, Error: err.Error()})
+				progress.setStatus(bar, "failed")
+				continue
+			}
+			if result.partial {
+				partial = true
+			} else {
+				cfg.layers.put(layer.Digest, result)
+			}
+		}
+
+		layerMeta := make(map[string]FileMeta, len(result.metadata))
+		for rel, meta := range result.metadata {
+			layerMeta[filepath.Join(extractedDir, rel)] = meta
+		}
+		composition.addLayer(layer, extractedDir, layerMeta)
+		fileTypes.addLayer(result.fileTypes, !cached)
+		if cfg.indexDir != "" {
+			indexed.Files = append(indexed.Files, indexFiles(layer, result.metadata)...)
+		}
+
+		for rel, matches := range result.matches {
+			path := filepath.Join(extractedDir, rel)
+			if matchesResult[path] == nil {
+				matchesResult[path] = make(map[string][]string)
+			}
+			for rule, found := range matches {
+				matchesResult[path][rule] = append([]string(nil), found...)
+				cfg.journal.record(journalEvent{Event: journalFinding, Image: image, Layer: layer.Digest, Path: "/" + filepath.ToSlash(rel), Rule: rule, Severity: ruleSeverity(rule), Count: len(found)})
+			}
+			meta := result.metadata[rel]
+			meta.Layer = layer.Digest
+			meta.Encoding = result.encodings[rel]
+			fileMetadata[path] = meta
+			if cached {
+				// Fresh layers log their findings as they are found.
+				logMatches(path, matches)
+			}
+		}
+		for _, artifact := range result.nested {
+			artifact.Layer = layer.Digest
+			nested = append(nested, artifact)
+			logger.Warn("embedded artifact found", "file", artifact.Path, "kind", artifact.Kind, "size", artifact.Size, "scanned", artifact.Scanned)
+		}
+		if result.envContent != "" {
+			envContent = result.envContent
+		}
+		contacts = append(contacts, result.contacts...)
+		progress.setStatus(bar, "done")
+		if partial {
+			break
+		}
+	}
+
+	partialReason := ""
+	if partial {
+		partialReason = fmt.Sprintf("max duration of %s exceeded", cfg.maxDuration)
+		switch {
+		case errors.Is(parent.Err(), context.DeadlineExceeded):
+			partialReason = "overall timeout reached"
+		case parent.Err() != nil:
+			partialReason = "interrupted"
+		}
+		logger.Warn("scan stopped early, results are partial", "image", image, "reason", partialReason)
+	} else {
+		logger.Info("image downloaded and extracted successfully", "image", image)
+	}
+
+	composition.finish()
+	fileTypes.finish(cfg.ignoreExtensions)
+	if len(fileTypes.SuggestedIgnore) > 0 {
+		logger.Info("file types that took scan time without matches", "extensions", strings.Join(fileTypes.SuggestedIgnore, ","))
+	}
+	if len(fileTypes.SuggestedIgnorePaths) > 0 {
+		logger.Info("directories that took scan time without matches", "paths", strings.Join(fileTypes.SuggestedIgnorePaths, ","))
+	}
+	if cfg.indexDir != "" {
+		if err := writeIndex(cfg.indexDir, indexed); err != nil {
+			logger.Warn("could not write content index", "error", err)
+		}
+	}
+
+	dropped := applyAllowlist(matchesResult, cfg.allowlist)
+	if dropped > 0 {
+		logger.Info("allowlisted matches suppressed", "count", dropped)
+	}
+	suppressed := suppressPlaceholders(matchesResult, cfg.placeholders)
+	if len(suppressed) > 0 {
+		logger.Info("placeholder matches suppressed", "count", len(suppressed))
+	}
+	if dropped > 0 || len(suppressed) > 0 {
+		for path := range fileMetadata {
+			if _, ok := matchesResult[path]; !ok {
+				delete(fileMetadata, path)
+			}
+		}
+	}
+
+	if ref.isDockerHub() {
+		contacts = append(contacts, hubProfileContacts(ref.Repo)...)
+	}
+
+	canaries := findCanaries(matchesResult)
+	for _, canary := range canaries {
+		logger.Warn("canary token found, this is bait and using it will raise an alert", "file", canary.Path, "rule", canary.Rule, "reason", canary.Reason)
+	}
+
+	lowConfidence := findLowConfidence(matchesResult, cfg.regexPatterns)
+	if len(lowConfidence) > 0 {
+		logger.Info("matches with invalid token structure marked low confidence", "count", len(lowConfidence))
+	}
+
+	score := riskScore(withoutCanaries(matchesResult), exposure)
+	logger.Info("risk score", "image", image, "score", score)
+
+	report := &Report{
+		SelectedRepo:  ref.name(),
+		SelectedTag:   ref.Tag,
+		Digest:        ref.Digest,
+		Platform:      platformName(manifest.Platform),
+		EnvContent:    envContent,
+		Matches:       matchesResult,
+		Exposure:      exposure,
+		RiskScore:     score,
+		Provenance:    provenance,
+		Remediation:   remediationsFor(matchesResult),
+		Labels:        labels,
+		Config:        configSummary,
+		FileMetadata:  fileMetadata,
+		Access:        access,
+		Partial:       partial,
+		PartialReason: partialReason,
+		Composition:   composition,
+		ScannedAt:     time.Now().UTC(),
+		Canaries:      canaries,
+		LowConfidence: lowConfidence,
+		Nested:        nested,
+		SkippedLayers: skippedLayers,
+		Suppressed:    suppressed,
+		Contacts:      mergeContacts(contacts),
+		Verification:  verification,
+		PullBudget:    budget,
+		Inputs: &ScanInputs{
+			ToolVersion:    version,
+			RulesDigest:    cfg.rulesDigest,
+			ManifestDigest: manifest.Digest,
+			ConfigDigest:   manifest.Config.Digest,
+			LayerDigests:   layerDigests(manifest.Layers),
+		},
+	}
+
+	if len(fileTypes.Types) > 0 {
+		report.FileTypes = fileTypes
+	}
+
+	return report, nil
+}
+
+func platformName(p *Platform) string {
+	if p == nil {
+		return ""
+	}
+	return p.String()
+}
+
+func layerDigests(layers []Descriptor) []string {
+	digests := make([]string, len(layers))
+	for i, layer := range layers {
+		digests[i] = layer.Digest
+	}
+	return digests
+}
+
+// Layer verification states recorded in the report.
+const (
+	layerVerified = "verified"
+	layerMismatch = "digest-mismatch"
+)
+
+// layerResult is what scanning one layer produced, keyed by path relative
+// to the layer root so it can be reused for every image sharing the layer.
+type layerResult struct {
+	metadata   map[string]FileMeta
+	matches    map[string]map[string][]string
+	encodings  map[string]string
+	envContent string
+	nested     []NestedArtifact
+	contacts   []DisclosureContact
+	fileTypes  *fileTally
+	partial    bool
+}
+
+type layerCache struct {
+	mu      sync.Mutex
+	results map[string]*layerResult
+}
+
+func newLayerCache() *layerCache {
+	return &layerCache{results: make(map[string]*layerResult)}
+}
+
+func (c *layerCache) get(digest string) (*layerResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	result, ok := c.results[digest]
+	return result, ok
+}
+
+func (c *layerCache) put(digest string, result *layerResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.results[digest] = result
+}
+
+func scanLayer(ctx context.Context, cfg *scanConfig, blobPath string, layer Descriptor, extractedDir string, bar *layerBar) (*layerResult, error) {
+	var layerMeta map[string]FileMeta
+	var err error
+	if isTarLayer(layer.MediaType) {
+		layerMeta, err = extractTarGz(ctx, blobPath, extractedDir, cfg.profile.FileContents)
+	} else {
+		layerMeta, err = extractArtifact(blobPath, layer, extractedDir, cfg.profile.FileContents)
+	}
+	if err != nil {
+		return nil, err
+	}
+	progress.setStatus(bar, "scanning")
+
+	result := &layerResult{
+		metadata:  make(map[string]FileMeta, len(layerMeta)),
+		matches:   make(map[string]map[string][]string),
+		encodings: make(map[string]string),
+		fileTypes: newFileTally(),
+	}
+	relative := func(path string) string {
+		rel, err := filepath.Rel(extractedDir, path)
+		if err != nil {
+			return path
+		}
+		return rel
+	}
+	for path, meta := range layerMeta {
+		result.metadata[relative(path)] = meta
+	}
+
+	if cfg.profile.SensitiveNames {
+		for path := range layerMeta {
+			if isSensitiveFile(path) {
+				result.matches[relative(path)] = map[string][]string{sensitiveFileRule: {filepath.Base(path)}}
+				logMatches(path, result.matches[relative(path)])
+			}
+		}
+	}
+	if !cfg.profile.FileContents {
+		return result, nil
+	}
+
+	var files []layerFile
+	filepath.Walk(extractedDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			files = append(files, layerFile{path: path, info: info})
+		}
+		return nil
+	})
+	sortByScanPriority(files, relative)
+
+	for _, file := range files {
+		if ctx.Err() != nil {
+			result.partial = true
+			break
+		}
+		path, info := file.path, file.info
+		skip := cfg.profile.IgnoreExtensions && (shouldSkipFile(path, cfg.ignoreExtensions) || shouldSkipDir(relative(path), cfg.ignoreExtensions))
+		if skip {
+			recordFileType(result.fileTypes, relative(path), info.Size(), true, 0, nil)
+			continue
+		}
+		started := time.Now()
+		content, err := os.ReadFile(path)
+		if err != nil {
+			logger.Warn("error reading file", "error", err)
+			continue
+		}
+		text, encoding := decodeContent(content)
+		if cfg.profile.BinaryStrings && bytes.IndexByte(content, 0) >= 0 && !strings.HasPrefix(encoding, "utf-16") {
+			text, encoding = printableStrings(content, 6), "strings"
+		}
+		if encoding != "utf-8" {
+			logger.Debug("transcoded file before scanning", "file", path, "encoding", encoding)
+		}
+		if filepath.Base(path) == ".env" {
+			logger.Info("found .env file", "file", path)
+			result.envContent = text
+			logger.Debug(".env content", "file", path, "content", text)
+		}
+		if rel := relative(path); isContactFile(rel) {
+			result.contacts = append(result.contacts, extractContacts(text, "file:/"+filepath.ToSlash(rel), true)...)
+		}
+		if kind := detectArtifact(path, content); kind != "" {
+			scanNestedArtifact(ctx, cfg, result, relative(path), path, kind, extractedDir+".nested", info.Size())
+		}
+		matches := checkPatterns(text, cfg.regexPatterns)
+		if urls := canaryURLPattern.FindAllString(text, -1); len(urls) > 0 {
+			matches[canaryURLRule] = urls
+		}
+		recordFileType(result.fileTypes, relative(path), info.Size(), false, time.Since(started), matches)
+		if len(matches) > 0 {
+			logMatches(path, matches)
+			rel := relative(path)
+			for rule, found := range result.matches[rel] {
+				matches[rule] = found
+			}
+			result.matches[rel] = matches
+			if encoding != "utf-8" {
+				result.encodings[rel] = encoding
+			}
+		}
+	}
+	return result, nil
+}
+
+// scanNestedArtifact records the artifact found at rel and, with
+// --scan-nested, merges the findings of its layers into result under
+// "<rel>!/<path in embedded image>".
+func scanNestedArtifact(ctx context.Context, cfg *scanConfig, result *layerResult, rel, path, kind, nestedDir string, size int64) {
+	artifact := NestedArtifact{Path: "/" + filepath.ToSlash(rel), Kind: kind, Size: size}
+	if filepath.Base(path) == "oci-layout" {
+		rel = filepath.Dir(rel)
+		artifact.Path = "/" + filepath.ToSlash(rel)
+	}
+	defer func() { result.nested = append(result.nested, artifact) }()
+
+	if !cfg.scanNested || (kind != artifactDockerArchive && kind != artifactOCILayout) {
+		return
+	}
+	if nestedDepthFrom(ctx) >= maxNestedDepth {
+		logger.Warn("not scanning embedded image, nested too deep", "file", artifact.Path)
+		return
+	}
+	workDir := filepath.Join(nestedDir, strconv.Itoa(len(result.nested)))
+	if !cfg.keepArtifacts {
+		defer removeDir(workDir)
+	}
+	inner, err := scanNested(ctx, cfg, path, kind, workDir)
+	if err != nil {
+		logger.Warn("could not scan embedded image", "file", artifact.Path, "error", err)
+		return
+	}
+	artifact.Scanned = true
+	for innerRel, matches := range inner.matches {
+		key := rel + "!" + string(filepath.Separator) + innerRel
+		result.matches[key] = matches
+		if encoding, ok := inner.encodings[innerRel]; ok {
+			result.encodings[key] = encoding
+		}
+	}
+	for _, deeper := range inner.nested {
+		deeper.Path = artifact.Path + "!" + deeper.Path
+		result.nested = append(result.nested, deeper)
+	}
+	if inner.partial {
+		result.partial = true
+	}
+}
+
+func logMatches(source string, matches map[string][]string) {
+	for pattern, matchedStrings := range matches {
+		for _, match := range matchedStrings {
+			logger.Info("match found", "file", source, "pattern", pattern, "severity", ruleSeverity(pattern), "match", match)
+		}
+	}
+}
+
+func emitReports(ctx context.Context, cfg *scanConfig, reports []*Report) {
+	linkDuplicates(reports, cfg.indexDir)
+	for _, sink := range cfg.sinks {
+		if err := sink.Emit(ctx, reports); err != nil {
+			logger.Error("error writing results", "sink", sink.Name(), "error", err)
+			continue
+		}
+		logger.Info("results saved", "sink", sink.Name())
+	}
+}
+
+func readImageList(filename string) ([]string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var refs []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		refs = append(refs, line)
+	}
+	return refs, scanner.Err()
+}
+
+// namespaceTargets lists every repository of the namespaces set with
+// --scan-namespace. Unless --all-tags or --latest pick the tags, each
+// repository is scanned at its most recently pushed tag, since many
+// organizations never push :latest.
+func namespaceTargets(namespaces []string, pickTag bool) ([]string, error) {
+	var refs []string
+	for _, namespace := range namespaces {
+		repos, err := listNamespaceRepositories(namespace, "")
+		if err != nil {
+			return nil, fmt.Errorf("failed to list repositories of %s: %w", namespace, err)
+		}
+		logger.Info("namespace enumerated", "namespace", namespace, "repositories", len(repos))
+		for _, repo := range repos {
+			if !pickTag {
+				refs = append(refs, repo.Name)
+				continue
+			}
+			tags, err := fetchRecentTags(repo.Name, 1)
+			if err != nil || len(tags) == 0 {
+				logger.Warn("no tag to scan", "repo", repo.Name, "error", err)
+				continue
+			}
+			refs = append(refs, repo.Name+":"+tags[0].Name)
+		}
+	}
+	return refs, nil
+}
+
+func scanTargets(ctx context.Context, cfg *scanConfig, refs []string, concurrency int) error {
+	if cfg.allTags || cfg.latest > 0 {
+		var err error
+		refs, err = expandTags(ctx, refs, cfg.latest)
+		if err != nil {
+			return err
+		}
+	}
+	if cfg.dryRun {
+		return previewTargets(ctx, refs)
+	}
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	targets := make([]imageRef, 0, len(refs))
+	for _, raw := range refs {
+		targets = append(targets, platformTargets(ctx, cfg, parseImageReference(raw))...)
+	}
+
+	reports := make([]*Report, len(targets))
+	errs := make([]error, len(targets))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if ctx.Err() != nil {
+					errs[i] = stopped(ctx)
+					continue
+				}
+				reports[i], errs[i] = scanImage(ctx, cfg, targets[i])
+			}
+		}()
+	}
+	for i := range targets {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	var completed []*Report
+	failed := 0
+	for i, err := range errs {
+		if err != nil && ctx.Err() != nil {
+			logger.Warn("image not scanned, interrupted", "image", targets[i].label())
+			continue
+		}
+		if err != nil {
+			logger.Error("error scanning image", "image", targets[i].label(), "error", err, "hint", errorHint(err))
+			failed++
+			continue
+		}
+		completed = append(completed, reports[i])
+	}
+	if len(completed) > 0 {
+		emitReports(ctx, cfg, completed)
+	}
+	if jsonOutput {
+		if err := printJSON(completed); err != nil {
+			return err
+		}
+	}
+
+	if ctx.Err() != nil {
+		return stopped(ctx)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d scans failed", failed, len(targets))
+	}
+	if cfg.failOn != "" {
+		findings := 0
+		for _, report := range filterReports(completed, cfg.failOn) {
+			findings += report.findingCount()
+		}
+		if findings > 0 {
+			return &exitError{code: exitFindings, err: fmt.Errorf("%d finding(s) at or above %s severity", findings, cfg.failOn)}
+		}
+	}
+	return nil
+}
+
+// platformTargets returns one target per platform of ref when the profile
+// scans every platform, and ref alone otherwise. A reference that cannot be
+// resolved here is left for the scan to report.
+func platformTargets(ctx context.Context, cfg *scanConfig, ref imageRef) []imageRef {
+	if !cfg.profile.AllPlatforms {
+		return []imageRef{ref}
+	}
+	platforms, err := indexPlatforms(ctx, ref)
+	if err != nil {
+		logger.Warn("could not list platforms", "image", ref.String(), "error", err)
+		return []imageRef{ref}
+	}
+	if len(platforms) == 0 {
+		return []imageRef{ref}
+	}
+	targets := make([]imageRef, len(platforms))
+	for i := range platforms {
+		targets[i] = ref
+		targets[i].Platform = &platforms[i]
+	}
+	logger.Info("scanning every platform", "image", ref.String(), "platforms", len(platforms))
+	return targets
+}
+
+// expandTags replaces each reference with one per tag of its repository:
+// the latest most recently pushed tags, or all of them when latest is 0.
+func expandTags(ctx context.Context, refs []string, latest int) ([]string, error) {
+	var expanded []string
+	seen := make(map[string]bool)
+	for _, raw := range refs {
+		ref := parseImageReference(raw)
+		repo := ref.name()
+		if seen[repo] {
+			continue
+		}
+		seen[repo] = true
+
+		var tags []datedTag
+		var err error
+		switch {
+		case !ref.isDockerHub() && latest > 0:
+			return nil, fmt.Errorf("--latest needs push dates, which only Docker Hub provides: %s", repo)
+		case !ref.isDockerHub():
+			tags, err = listRegistryTags(ctx, ref)
+		case latest > 0:
+			tags, err = fetchRecentTags(repo, latest)
+		default:
+			tags, err = fetchAllTags(repo)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list tags of %s: %w", repo, err)
+		}
+		for _, tag := range tags {
+			logger.Info("selected tag", "repo", repo, "tag", tag.Name, "pushed", tag.LastUpdated)
+		}
+		for _, tag := range tags {
+			expanded = append(expanded, repo+":"+tag.Name)
+		}
+	}
+	return expanded, nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	mediaTypeDockerManifestV1       = "application/vnd.docker.distribution.manifest.v1+json"
+	mediaTypeDockerManifestV1Signed = "application/vnd.docker.distribution.manifest.v1+prettyjws"
+)
+
+// schema1Manifest is the legacy Docker image manifest. Layers are listed
+// top layer first, each with the v1 image JSON that stood in for the config
+// blob.
+type schema1Manifest struct {
+	SchemaVersion int    `json:"schemaVersion"`
+	Name          string `json:"name"`
+	Tag           string `json:"tag"`
+	Architecture  string `json:"architecture"`
+	FSLayers      []struct {
+		BlobSum string `json:"blobSum"`
+	} `json:"fsLayers"`
+	History []struct {
+		V1Compatibility string `json:"v1Compatibility"`
+	} `json:"history"`
+}
+
+// v1Image is the part of a v1Compatibility entry DockerSpy uses.
+type v1Image struct {
+	Created         string          `json:"created"`
+	Author          string          `json:"author"`
+	Architecture    string          `json:"architecture"`
+	OS              string          `json:"os"`
+	Config          ContainerConfig `json:"config"`
+	ContainerConfig struct {
+		Cmd []string `json:"Cmd"`
+	} `json:"container_config"`
+	ThrowAway bool `json:"throwaway"`
+}
+
+// convertSchema1 turns a schema 1 manifest into the layers, base first, and
+// an image config rebuilt from the v1 history. Layers marked throwaway are
+// empty and left out.
+func convertSchema1(body []byte) (*Manifest, error) {
+	var legacy schema1Manifest
+	if err := json.Unmarshal(body, &legacy); err != nil {
+		return nil, err
+	}
+	if len(legacy.FSLayers) != len(legacy.History) {
+		return nil, fmt.Errorf("schema 1 manifest has %d layers but %d history entries", len(legacy.FSLayers), len(legacy.History))
+	}
+
+	manifest := &Manifest{MediaType: mediaTypeDockerManifestV1Signed}
+	config := &ImageConfig{Architecture: legacy.Architecture}
+	for i := len(legacy.FSLayers) - 1; i >= 0; i-- {
+		var image v1Image
+		if err := json.Unmarshal([]byte(legacy.History[i].V1Compatibility), &image); err != nil {
+			return nil, fmt.Errorf("invalid v1Compatibility entry: %v", err)
+		}
+		config.History = append(config.History, HistoryEntry{
+			Created:    image.Created,
+			CreatedBy:  joinCmd(image.ContainerConfig.Cmd),
+			Author:     image.Author,
+			EmptyLayer: image.ThrowAway,
+		})
+		if !image.ThrowAway {
+			manifest.Layers = append(manifest.Layers, Descriptor{Digest: legacy.FSLayers[i].BlobSum})
+		}
+		if i == 0 {
+			config.OS, config.Created, config.Author, config.Config = image.OS, image.Created, image.Author, image.Config
+			if image.Architecture != "" {
+				config.Architecture = image.Architecture
+			}
+		}
+	}
+	manifest.legacyConfig = config
+	return manifest, nil
+}
+
+func joinCmd(cmd []string) string {
+	data, _ := json.Marshal(cmd)
+	if len(cmd) == 3 && cmd[0] == "/bin/sh" && cmd[1] == "-c" {
+		return "/bin/sh -c " + cmd[2]
+	}
+	return string(data)
+}
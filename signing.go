@@ -0,0 +1,182 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// ScanInputs pins what a report was produced from, so a report handed over
+// in a disclosure can be tied to an exact tool, rule set and image.
+type ScanInputs struct {
+	ToolVersion    string   `json:"toolVersion"`
+	RulesDigest    string   `json:"rulesDigest"`
+	ManifestDigest string   `json:"manifestDigest,omitempty"`
+	ConfigDigest   string   `json:"configDigest,omitempty"`
+	LayerDigests   []string `json:"layerDigests,omitempty"`
+}
+
+// rulesDigest fingerprints the patterns and ignore list a scan ran with.
+func rulesDigest(patterns map[string]Matcher, ignoreExtensions []string) string {
+	names := make([]string, 0, len(patterns))
+	for name := range patterns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	hasher := sha256.New()
+	for _, name := range names {
+		fmt.Fprintf(hasher, "%s\x00%s\x00", name, patterns[name].String())
+	}
+	ignore := append([]string(nil), ignoreExtensions...)
+	sort.Strings(ignore)
+	for _, ext := range ignore {
+		fmt.Fprintf(hasher, "%s\x00", ext)
+	}
+	return "sha256:" + hex.EncodeToString(hasher.Sum(nil))
+}
+
+// reportSigner signs every report file written when --sign-key is set.
+var reportSigner *signer
+
+// signer produces detached signatures in the format `cosign verify-blob`
+// accepts: the base64 encoding of an ECDSA P-256, RSA or Ed25519 signature
+// over the file. Encrypted cosign keys are handed to the cosign binary.
+type signer struct {
+	keyPath string
+	key     crypto.Signer
+}
+
+func loadSigner(path string) (*signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s is not a PEM private key", path)
+	}
+	if strings.HasPrefix(block.Type, "ENCRYPTED") {
+		if _, err := exec.LookPath("cosign"); err != nil {
+			return nil, fmt.Errorf("%s is an encrypted key and needs the cosign binary: %v", path, err)
+		}
+		return &signer{keyPath: path}, nil
+	}
+
+	var parsed interface{}
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		parsed, err = x509.ParseECPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	key, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%s holds an unsupported key type", path)
+	}
+	return &signer{keyPath: path, key: key}, nil
+}
+
+func (s *signer) sign(data []byte) ([]byte, error) {
+	var sig []byte
+	var err error
+	switch key := s.key.(type) {
+	case ed25519.PrivateKey:
+		sig = ed25519.Sign(key, data)
+	case *ecdsa.PrivateKey, *rsa.PrivateKey:
+		digest := sha256.Sum256(data)
+		sig, err = key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	default:
+		return nil, fmt.Errorf("unsupported signing key %T", key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []byte(base64.StdEncoding.EncodeToString(sig)), nil
+}
+
+// signFile writes the detached signature of path to path.sig.
+func (s *signer) signFile(path string) error {
+	sigPath := path + ".sig"
+	if s.key == nil {
+		cmd := exec.Command("cosign", "sign-blob", "--yes", "--key", s.keyPath, "--output-signature", sigPath, path)
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("cosign sign-blob failed: %v", err)
+		}
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	sig, err := s.sign(data)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(sigPath, sig, 0o644)
+}
+
+// verifyFile checks path against path.sig with a PEM public key.
+func verifyFile(path, publicKeyPath string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	encoded, err := os.ReadFile(path + ".sig")
+	if err != nil {
+		return err
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+	if err != nil {
+		return fmt.Errorf("malformed signature: %v", err)
+	}
+
+	keyData, err := os.ReadFile(publicKeyPath)
+	if err != nil {
+		return err
+	}
+	block, _ := pem.Decode(keyData)
+	if block == nil {
+		return fmt.Errorf("%s is not a PEM public key", publicKeyPath)
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %v", publicKeyPath, err)
+	}
+
+	digest := sha256.Sum256(data)
+	valid := false
+	switch key := pub.(type) {
+	case ed25519.PublicKey:
+		valid = ed25519.Verify(key, data, sig)
+	case *ecdsa.PublicKey:
+		valid = ecdsa.VerifyASN1(key, digest[:], sig)
+	case *rsa.PublicKey:
+		valid = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig) == nil
+	default:
+		return fmt.Errorf("unsupported public key %T", key)
+	}
+	if !valid {
+		return fmt.Errorf("signature does not match %s", path)
+	}
+	return nil
+}
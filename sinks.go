@@ -0,0 +1,381 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+type SinkConfig struct {
+	Type        string            `json:"type"`
+	Format      string            `json:"format"`
+	MinSeverity string            `json:"minSeverity"`
+	Path        string            `json:"path"`
+	URL         string            `json:"url"`
+	Headers     map[string]string `json:"headers"`
+	Index       string            `json:"index"`
+	Bucket      string            `json:"bucket"`
+	Region      string            `json:"region"`
+	Prefix      string            `json:"prefix"`
+	Retries     int               `json:"retries,omitempty"`
+}
+
+type Sink interface {
+	Name() string
+	// Emit delivers reports. ctx only cuts retries short; an interrupted
+	// run still delivers what it has.
+	Emit(ctx context.Context, reports []*Report) error
+}
+
+var sinkFactories = map[string]func(SinkConfig) (Sink, error){
+	"console": newConsoleSink,
+	"file":    newFileSink,
+	"webhook": newWebhookSink,
+	"slack":   newSlackSink,
+	"elastic": newElasticSink,
+	"s3":      newS3Sink,
+}
+
+var defaultSinks = []SinkConfig{{Type: "file", Path: "results.json", Format: "json"}}
+
+func loadSinks(filename, outputPath string) ([]Sink, error) {
+	// Decode into an empty slice: decoding over the defaults would carry
+	// the default file sink's fields into the first configured sink.
+	var configs []SinkConfig
+	if filename != "" {
+		file, err := os.Open(filename)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if err == nil {
+			defer file.Close()
+			if err := json.NewDecoder(file).Decode(&configs); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(configs) == 0 {
+		configs = append([]SinkConfig(nil), defaultSinks...)
+	}
+
+	if outputPath != "" {
+		configs = overrideOutputPath(configs, outputPath)
+	}
+
+	var sinks []Sink
+	for _, config := range configs {
+		factory, ok := sinkFactories[config.Type]
+		if !ok {
+			return nil, fmt.Errorf("unknown sink type: %s", config.Type)
+		}
+		if config.MinSeverity != "" && severityRank[config.MinSeverity] == 0 {
+			return nil, fmt.Errorf("unknown severity for %s sink: %s", config.Type, config.MinSeverity)
+		}
+		sink, err := factory(config)
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure %s sink: %v", config.Type, err)
+		}
+		if remoteSinks[config.Type] && config.Retries >= 0 {
+			sink = &retryingSink{Sink: sink, config: config}
+		}
+		sinks = append(sinks, sink)
+	}
+	return sinks, nil
+}
+
+func overrideOutputPath(configs []SinkConfig, outputPath string) []SinkConfig {
+	for i := range configs {
+		if configs[i].Type == "file" {
+			configs[i].Path = outputPath
+			return configs
+		}
+	}
+	return append(configs, SinkConfig{Type: "file", Path: outputPath, Format: "json"})
+}
+
+func renderForSink(config SinkConfig, reports []*Report) ([]byte, error) {
+	return formatReports(filterReports(reports, config.MinSeverity), config.Format)
+}
+
+type consoleSink struct {
+	config SinkConfig
+}
+
+func newConsoleSink(config SinkConfig) (Sink, error) {
+	if config.Format == "" {
+		config.Format = "text"
+	}
+	return &consoleSink{config: config}, nil
+}
+
+func (s *consoleSink) Name() string { return "console" }
+
+func (s *consoleSink) Emit(ctx context.Context, reports []*Report) error {
+	data, err := renderForSink(s.config, reports)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(humanOutput(), string(data))
+	return err
+}
+
+type fileSink struct {
+	config SinkConfig
+}
+
+func newFileSink(config SinkConfig) (Sink, error) {
+	if config.Path == "" {
+		return nil, fmt.Errorf("missing path")
+	}
+	return &fileSink{config: config}, nil
+}
+
+func (s *fileSink) Name() string { return s.config.Path }
+
+func (s *fileSink) Emit(ctx context.Context, reports []*Report) error {
+	data, err := renderForSink(s.config, reports)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(s.config.Path, append(data, '\n'), 0o600); err != nil {
+		return err
+	}
+	if reportSigner != nil {
+		return reportSigner.signFile(s.config.Path)
+	}
+	return nil
+}
+
+func postBody(url, contentType string, headers map[string]string, body []byte) error {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &sinkStatusError{Code: resp.StatusCode, Status: resp.Status}
+	}
+	return nil
+}
+
+type webhookSink struct {
+	config SinkConfig
+}
+
+func newWebhookSink(config SinkConfig) (Sink, error) {
+	if config.URL == "" {
+		return nil, fmt.Errorf("missing url")
+	}
+	return &webhookSink{config: config}, nil
+}
+
+func (s *webhookSink) Name() string { return "webhook " + s.config.URL }
+
+func (s *webhookSink) Emit(ctx context.Context, reports []*Report) error {
+	data, err := renderForSink(s.config, reports)
+	if err != nil {
+		return err
+	}
+	contentType := "application/json"
+	if s.config.Format == "text" {
+		contentType = "text/plain"
+	}
+	return postBody(s.config.URL, contentType, s.config.Headers, data)
+}
+
+type slackSink struct {
+	config SinkConfig
+}
+
+func newSlackSink(config SinkConfig) (Sink, error) {
+	if config.URL == "" {
+		return nil, fmt.Errorf("missing url")
+	}
+	config.Format = "text"
+	return &slackSink{config: config}, nil
+}
+
+func (s *slackSink) Name() string { return "slack" }
+
+func (s *slackSink) Emit(ctx context.Context, reports []*Report) error {
+	data, err := renderForSink(s.config, reports)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(map[string]string{"text": "```" + string(data) + "```"})
+	if err != nil {
+		return err
+	}
+	return postBody(s.config.URL, "application/json", s.config.Headers, payload)
+}
+
+type elasticSink struct {
+	config SinkConfig
+}
+
+func newElasticSink(config SinkConfig) (Sink, error) {
+	if config.URL == "" {
+		return nil, fmt.Errorf("missing url")
+	}
+	if config.Index == "" {
+		config.Index = "dockerspy"
+	}
+	config.Format = "json"
+	return &elasticSink{config: config}, nil
+}
+
+func (s *elasticSink) Name() string { return "elastic " + s.config.Index }
+
+func (s *elasticSink) Emit(ctx context.Context, reports []*Report) error {
+	url := fmt.Sprintf("%s/%s/_doc", strings.TrimRight(s.config.URL, "/"), s.config.Index)
+	for _, report := range reports {
+		data, err := renderForSink(s.config, []*Report{report})
+		if err != nil {
+			return err
+		}
+		if err := postBody(url, "application/json", s.config.Headers, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type s3Sink struct {
+	config SinkConfig
+}
+
+func newS3Sink(config SinkConfig) (Sink, error) {
+	if config.Bucket == "" {
+		return nil, fmt.Errorf("missing bucket")
+	}
+	if config.Region == "" {
+		config.Region = os.Getenv("AWS_REGION")
+	}
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+	if os.Getenv("AWS_ACCESS_KEY_ID") == "" || os.Getenv("AWS_SECRET_ACCESS_KEY") == "" {
+		return nil, fmt.Errorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set")
+	}
+	return &s3Sink{config: config}, nil
+}
+
+func (s *s3Sink) Name() string { return "s3://" + s.config.Bucket }
+
+func (s *s3Sink) Emit(ctx context.Context, reports []*Report) error {
+	data, err := renderForSink(s.config, reports)
+	if err != nil {
+		return err
+	}
+
+	extension := "json"
+	if s.config.Format == "text" {
+		extension = "txt"
+	}
+	name := "batch"
+	if len(reports) == 1 {
+		name = strings.NewReplacer("/", "_", ":", "_", "@", "_").Replace(reportImage(reports[0]))
+	}
+	key := fmt.Sprintf("%s%s_%d.%s", s.config.Prefix, name, time.Now().Unix(), extension)
+
+	host := fmt.Sprintf("%s.s3.%s.amazonaws.com", s.config.Bucket, s.config.Region)
+	req, err := http.NewRequest("PUT", "https://"+host+"/"+key, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	signS3Request(req, data, s.config.Region)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return &sinkStatusError{Code: resp.StatusCode, Status: resp.Status}
+	}
+	return nil
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// signS3Request applies AWS Signature Version 4 using credentials from the
+// standard AWS environment variables.
+func signS3Request(req *http.Request, body []byte, region string) {
+	signAWSRequest(req, body, region, "s3")
+}
+
+// signAWSRequest signs req for service. Host, Content-Type and every
+// X-Amz-* header are signed.
+func signAWSRequest(req *http.Request, body []byte, region, service string) {
+	now := time.Now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256.Sum256(body)
+	payloadHex := hex.EncodeToString(payloadHash[:])
+
+	req.Header.Set("Host", req.URL.Host)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHex)
+	if session := os.Getenv("AWS_SESSION_TOKEN"); session != "" {
+		req.Header.Set("X-Amz-Security-Token", session)
+	}
+	var names []string
+	for name := range req.Header {
+		lower := strings.ToLower(name)
+		if lower == "host" || lower == "content-type" || strings.HasPrefix(lower, "x-amz-") {
+			names = append(names, lower)
+		}
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", name, strings.TrimSpace(req.Header.Get(name)))
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		"",
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHex,
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+
+	scope := fmt.Sprintf("%s/%s/%s/aws4_request", date, region, service)
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, hex.EncodeToString(requestHash[:])}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+os.Getenv("AWS_SECRET_ACCESS_KEY")), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		os.Getenv("AWS_ACCESS_KEY_ID"), scope, signedHeaders, signature))
+}
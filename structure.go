@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+)
+
+// LowConfidenceMatch is a match shaped like a token type with a verifiable
+// structure that fails the check, such as a GitHub token whose checksum does
+// not add up. It is most likely a truncated, mistyped or made-up value.
+type LowConfidenceMatch struct {
+	Path   string `json:"path"`
+	Rule   string `json:"rule"`
+	Match  string `json:"match"`
+	Reason string `json:"reason"`
+}
+
+var (
+	githubTokenPattern = regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36}\b`)
+	awsKeyShapePattern = regexp.MustCompile(`\b(?:AKIA|ASIA|ABIA|ACCA|AGPA|AIDA|AIPA|ANPA|ANVA|APKA|AROA|ASCA)[A-Z0-9]{16}\b`)
+	jwtPattern         = regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*\.?[A-Za-z0-9_-]*`)
+	cardNumberPattern  = regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`)
+)
+
+const base62Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+func base62(n uint32) string {
+	var out []byte
+	for n > 0 {
+		out = append([]byte{base62Alphabet[n%62]}, out...)
+		n /= 62
+	}
+	return string(out)
+}
+
+// validGitHubToken checks the trailing six characters, the base62 CRC32 of
+// the 30 random characters before them. Some tools compute it over the
+// prefix as well, so both are accepted.
+func validGitHubToken(token string) bool {
+	body, checksum := token[:len(token)-6], token[len(token)-6:]
+	random := body[strings.Index(body, "_")+1:]
+	for _, data := range []string{random, body} {
+		if fmt.Sprintf("%06s", base62(crc32.ChecksumIEEE([]byte(data)))) == checksum {
+			return true
+		}
+	}
+	return false
+}
+
+// validAWSKeyID checks that the 16 characters after the prefix are base32,
+// as every issued access key ID is.
+func validAWSKeyID(keyID string) bool {
+	return strings.Trim(keyID[4:], "ABCDEFGHIJKLMNOPQRSTUVWXYZ234567") == ""
+}
+
+// jwtProblem returns why token is not a well-formed JWT, or "".
+func jwtProblem(token string) string {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "JWT without three parts"
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if data, err := base64.RawURLEncoding.DecodeString(parts[0]); err != nil || json.Unmarshal(data, &header) != nil || header.Alg == "" {
+		return "JWT header is not JSON with an alg"
+	}
+	var payload map[string]interface{}
+	if data, err := base64.RawURLEncoding.DecodeString(parts[1]); err != nil || json.Unmarshal(data, &payload) != nil {
+		return "JWT payload is not a JSON object"
+	}
+	if !strings.EqualFold(header.Alg, "none") {
+		if signature, err := base64.RawURLEncoding.DecodeString(parts[2]); err != nil || len(signature) == 0 {
+			return "JWT signature missing or not base64url"
+		}
+	}
+	return ""
+}
+
+// luhnValid applies the Luhn checksum every payment card number satisfies.
+func luhnValid(number string) bool {
+	sum, double := 0, false
+	for i := len(number) - 1; i >= 0; i-- {
+		digit := int(number[i] - '0')
+		if double {
+			if digit *= 2; digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// maxMatchLength is the longest match pattern can produce, or -1 when it is
+// unbounded or cannot be parsed as RE2.
+func maxMatchLength(pattern string) int {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return -1
+	}
+	return maxLength(re.Simplify())
+}
+
+func maxLength(re *syntax.Regexp) int {
+	switch re.Op {
+	case syntax.OpLiteral:
+		return len(string(re.Rune))
+	case syntax.OpCharClass, syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		return utf8MaxBytes(re)
+	case syntax.OpCapture, syntax.OpQuest:
+		return maxLength(re.Sub[0])
+	case syntax.OpRepeat:
+		n := maxLength(re.Sub[0])
+		if n < 0 || re.Max < 0 {
+			return -1
+		}
+		return n * re.Max
+	case syntax.OpConcat:
+		total := 0
+		for _, sub := range re.Sub {
+			n := maxLength(sub)
+			if n < 0 {
+				return -1
+			}
+			total += n
+		}
+		return total
+	case syntax.OpAlternate:
+		longest := 0
+		for _, sub := range re.Sub {
+			n := maxLength(sub)
+			if n < 0 {
+				return -1
+			}
+			if n > longest {
+				longest = n
+			}
+		}
+		return longest
+	case syntax.OpStar, syntax.OpPlus:
+		return -1
+	}
+	// Empty matches and assertions such as \b.
+	return 0
+}
+
+// utf8MaxBytes is how many bytes one character of a class can take.
+func utf8MaxBytes(re *syntax.Regexp) int {
+	if re.Op == syntax.OpCharClass && len(re.Rune) > 0 && re.Rune[len(re.Rune)-1] < 0x80 {
+		return 1
+	}
+	return 4
+}
+
+// structureProblem checks every token of a verifiable type in match. It
+// returns why the match looks invalid, or "" when it holds at least one
+// valid token or none whose structure can be checked. A capped match ran
+// into the rule's length limit, so a JWT in it is cut off rather than
+// malformed and is not checked.
+func structureProblem(rule, match string, capped bool) string {
+	var problems []string
+	valid := false
+	check := func(ok bool, problem string) {
+		if ok {
+			valid = true
+		} else {
+			problems = append(problems, problem)
+		}
+	}
+	for _, token := range githubTokenPattern.FindAllString(match, -1) {
+		check(validGitHubToken(token), "GitHub token checksum does not match")
+	}
+	for _, keyID := range awsKeyShapePattern.FindAllString(match, -1) {
+		check(validAWSKeyID(keyID), "AWS key ID is not base32")
+	}
+	if !capped {
+		for _, token := range jwtPattern.FindAllString(match, -1) {
+			problem := jwtProblem(token)
+			check(problem == "", problem)
+		}
+	}
+	if strings.Contains(strings.ToLower(rule), "card") {
+		for _, number := range cardNumberPattern.FindAllString(match, -1) {
+			check(luhnValid(strings.NewReplacer(" ", "", "-", "").Replace(number)), "card number fails the Luhn check")
+		}
+	}
+	if valid || len(problems) == 0 {
+		return ""
+	}
+	return problems[0]
+}
+
+// findLowConfidence lists the matches whose structure is invalid. Nothing is
+// sent anywhere; the checks are offline.
+func findLowConfidence(matches map[string]map[string][]string, patterns map[string]Matcher) []LowConfidenceMatch {
+	limits := make(map[string]int)
+	for rule, pattern := range patterns {
+		limits[rule] = maxMatchLength(pattern.String())
+	}
+	var found []LowConfidenceMatch
+	for path, rules := range matches {
+		for rule, values := range rules {
+			limit, ok := limits[rule]
+			for _, match := range values {
+				capped := ok && limit > 0 && len(match) >= limit
+				if reason := structureProblem(rule, match, capped); reason != "" {
+					found = append(found, LowConfidenceMatch{Path: path, Rule: rule, Match: match, Reason: reason})
+				}
+			}
+		}
+	}
+	return found
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/table"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+type tuiState int
+
+const (
+	stateSearch tuiState = iota
+	stateResults
+	stateTags
+)
+
+var sortOrders = []string{"stars", "pulls", "name"}
+
+type searchDoneMsg struct {
+	results []RepositorySummary
+	err     error
+}
+
+type tagsDoneMsg struct {
+	tags []TagSummary
+	err  error
+}
+
+// browserModel is the full-screen search/tag picker used by the interactive
+// mode. It ends with either a repository and the tags to scan, or quit.
+type browserModel struct {
+	state     tuiState
+	input     textinput.Model
+	filtering bool
+	filter    string
+	sortBy    int
+	table     table.Model
+	results   []RepositorySummary
+	visible   []RepositorySummary
+	repo      string
+	tags      []string
+	tagInfo   map[string]TagSummary
+	selected  map[string]bool
+	status    string
+	quit      bool
+}
+
+func newBrowserModel() browserModel {
+	input := textinput.New()
+	input.Placeholder = "search term"
+	input.Focus()
+
+	t := table.New(table.WithFocused(true), table.WithHeight(20))
+	t.SetStyles(table.DefaultStyles())
+
+	return browserModel{input: input, table: t, selected: make(map[string]bool)}
+}
+
+func searchCmd(term string) tea.Cmd {
+	return func() tea.Msg {
+		results, err := searchRepositories(term)
+		return searchDoneMsg{results: results, err: err}
+	}
+}
+
+func tagsCmd(repo string) tea.Cmd {
+	return func() tea.Msg {
+		tagsResult, err := fetchTags(repo)
+		if err != nil {
+			return tagsDoneMsg{err: err}
+		}
+		return tagsDoneMsg{tags: tagsResult.Results}
+	}
+}
+
+func (m browserModel) Init() tea.Cmd {
+	return textinput.Blink
+}
+
+func (m browserModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case searchDoneMsg:
+		if msg.err != nil {
+			m.status = fmt.Sprintf("search failed: %v (%s)", msg.err, errorHint(msg.err))
+			m.state = stateSearch
+			m.input.Focus()
+			return m, nil
+		}
+		m.results = msg.results
+		m.filter = ""
+		m.state = stateResults
+		m.status = ""
+		m.showResults()
+		return m, nil
+
+	case tagsDoneMsg:
+		if msg.err != nil {
+			m.status = fmt.Sprintf("could not list tags: %v (%s)", msg.err, errorHint(msg.err))
+			m.state = stateResults
+			m.showResults()
+			return m, nil
+		}
+		m.tags = nil
+		m.tagInfo = make(map[string]TagSummary)
+		for _, tag := range msg.tags {
+			m.tags = append(m.tags, tag.Name)
+			m.tagInfo[tag.Name] = tag
+		}
+		m.selected = make(map[string]bool)
+		m.state = stateTags
+		m.status = ""
+		m.showTags()
+		return m, nil
+
+	case tea.KeyMsg:
+		if msg.Type == tea.KeyCtrlC {
+			m.quit = true
+			return m, tea.Quit
+		}
+		if m.state == stateSearch || m.filtering {
+			return m.updateInput(msg)
+		}
+		return m.updateTable(msg)
+	}
+	return m, nil
+}
+
+func (m browserModel) updateInput(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.Type {
+	case tea.KeyEsc:
+		if m.filtering {
+			m.filtering = false
+			m.input.Reset()
+			return m, nil
+		}
+		m.quit = true
+		return m, tea.Quit
+	case tea.KeyEnter:
+		value := strings.TrimSpace(m.input.Value())
+		m.input.Reset()
+		if m.filtering {
+			m.filtering = false
+			m.filter = value
+			m.showResults()
+			return m, nil
+		}
+		if value == "" {
+			return m, nil
+		}
+		m.input.Blur()
+		m.status = fmt.Sprintf("searching for %q...", value)
+		return m, searchCmd(value)
+	}
+
+	var cmd tea.Cmd
+	m.input, cmd = m.input.Update(msg)
+	return m, cmd
+}
+
+func (m browserModel) updateTable(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "q":
+		m.quit = true
+		return m, tea.Quit
+	case "esc":
+		if m.state == stateTags {
+			m.state = stateResults
+			m.showResults()
+			return m, nil
+		}
+		m.state = stateSearch
+		m.input.Placeholder = "search term"
+		m.input.Focus()
+		return m, textinput.Blink
+	case "/":
+		if m.state == stateResults {
+			m.filtering = true
+			m.input.Placeholder = "filter"
+			m.input.SetValue(m.filter)
+			m.input.Focus()
+			return m, textinput.Blink
+		}
+	case "s":
+		if m.state == stateResults {
+			m.sortBy = (m.sortBy + 1) % len(sortOrders)
+			m.showResults()
+			return m, nil
+		}
+	case " ":
+		if m.state == stateTags && len(m.tags) > 0 {
+			tag := m.tags[m.table.Cursor()]
+			m.selected[tag] = !m.selected[tag]
+			cursor := m.table.Cursor()
+			m.showTags()
+			m.table.SetCursor(cursor)
+			return m, nil
+		}
+	case "enter":
+		switch m.state {
+		case stateResults:
+			if len(m.visible) == 0 {
+				return m, nil
+			}
+			m.repo = m.visible[m.table.Cursor()].Name
+			m.status = fmt.Sprintf("listing tags of %s...", m.repo)
+			return m, tagsCmd(m.repo)
+		case stateTags:
+			if len(m.selectedTags()) == 0 && len(m.tags) > 0 {
+				m.selected[m.tags[m.table.Cursor()]] = true
+			}
+			return m, tea.Quit
+		}
+	}
+
+	var cmd tea.Cmd
+	m.table, cmd = m.table.Update(msg)
+	return m, cmd
+}
+
+func (m *browserModel) showResults() {
+	m.visible = nil
+	filter := strings.ToLower(m.filter)
+	for _, result := range m.results {
+		if filter == "" || strings.Contains(strings.ToLower(result.Name+" "+result.Description), filter) {
+			m.visible = append(m.visible, result)
+		}
+	}
+	sort.SliceStable(m.visible, func(i, j int) bool {
+		switch sortOrders[m.sortBy] {
+		case "pulls":
+			return m.visible[i].PullCount > m.visible[j].PullCount
+		case "name":
+			return m.visible[i].Name < m.visible[j].Name
+		default:
+			return m.visible[i].StarCount > m.visible[j].StarCount
+		}
+	})
+
+	rows := make([]table.Row, len(m.visible))
+	for i, result := range m.visible {
+		official := ""
+		if result.IsOfficial {
+			official = "yes"
+		}
+		rows[i] = table.Row{result.Name, strconv.Itoa(result.StarCount), strconv.Itoa(result.PullCount), official, result.Description}
+	}
+	m.table.SetRows(nil)
+	m.table.SetColumns([]table.Column{
+		{Title: "Name", Width: 30},
+		{Title: "Stars", Width: 7},
+		{Title: "Pulls", Width: 12},
+		{Title: "Official", Width: 8},
+		{Title: "Description", Width: 50},
+	})
+	m.table.SetRows(rows)
+	m.table.SetCursor(0)
+}
+
+func (m *browserModel) showTags() {
+	rows := make([]table.Row, len(m.tags))
+	for i, tag := range m.tags {
+		mark := "[ ]"
+		if m.selected[tag] {
+			mark = "[x]"
+		}
+		info := m.tagInfo[tag]
+		size := ""
+		if info.FullSize > 0 {
+			size = formatBytes(info.FullSize)
+		}
+		rows[i] = table.Row{mark, tag, info.pushed(), size, info.architectures()}
+	}
+	m.table.SetRows(nil)
+	m.table.SetColumns([]table.Column{
+		{Title: "", Width: 3},
+		{Title: "Tag", Width: 40},
+		{Title: "Pushed", Width: 10},
+		{Title: "Size", Width: 10},
+		{Title: "Architectures", Width: 40},
+	})
+	m.table.SetRows(rows)
+	m.table.SetCursor(0)
+}
+
+func (m browserModel) selectedTags() []string {
+	var tags []string
+	for _, tag := range m.tags {
+		if m.selected[tag] {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+func (m browserModel) View() string {
+	var b strings.Builder
+	switch {
+	case m.state == stateSearch:
+		b.WriteString("Search Docker Hub\n\n" + m.input.View() + "\n\n")
+		b.WriteString("enter search • esc quit\n")
+	case m.state == stateResults:
+		fmt.Fprintf(&b, "%d of %d results, sorted by %s", len(m.visible), len(m.results), sortOrders[m.sortBy])
+		if m.filter != "" {
+			fmt.Fprintf(&b, ", filter %q", m.filter)
+		}
+		b.WriteString("\n\n" + m.table.View() + "\n\n")
+		if m.filtering {
+			b.WriteString(m.input.View() + "\n")
+		} else {
+			b.WriteString("enter list tags • / filter • s sort • esc new search • q quit\n")
+		}
+	case m.state == stateTags:
+		fmt.Fprintf(&b, "Tags of %s (%d selected)\n\n", m.repo, len(m.selectedTags()))
+		b.WriteString(m.table.View() + "\n\n")
+		b.WriteString("space select • enter scan • esc back • q quit\n")
+	}
+	if m.status != "" {
+		b.WriteString("\n" + m.status + "\n")
+	}
+	return b.String()
+}
+
+// browseImages runs the picker and returns the chosen repository and tags.
+// ok is false when the user quit without choosing anything.
+func browseImages() (repo string, tags []string, ok bool, err error) {
+	final, err := tea.NewProgram(newBrowserModel(), tea.WithAltScreen()).Run()
+	if err != nil {
+		return "", nil, false, err
+	}
+	m := final.(browserModel)
+	if m.quit {
+		return "", nil, false, nil
+	}
+	return m.repo, m.selectedTags(), true, nil
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// version and releasePublicKey are set by release builds with
+// -ldflags "-X main.version=... -X main.releasePublicKey=<hex ed25519 key>".
+var (
+	version          = "1.1"
+	releasePublicKey = ""
+)
+
+const (
+	latestReleaseURL = "https://api.github.com/repos/UndeadSec/DockerSpy/releases/latest"
+	maxReleaseAsset  = 256 << 20
+)
+
+var ruleFiles = []string{"regex_patterns.json", "ignore_extensions.json", "placeholders.json"}
+
+// rulesVersionFile records which release the installed rules came from.
+const rulesVersionFile = "VERSION"
+
+type release struct {
+	TagName string         `json:"tag_name"`
+	Assets  []releaseAsset `json:"assets"`
+}
+
+type releaseAsset struct {
+	Name string `json:"name"`
+	URL  string `json:"browser_download_url"`
+}
+
+func (r *release) version() string {
+	return strings.TrimPrefix(r.TagName, "v")
+}
+
+func (r *release) asset(name string) (string, bool) {
+	for _, asset := range r.Assets {
+		if asset.Name == name {
+			return asset.URL, true
+		}
+	}
+	return "", false
+}
+
+func binaryAssetName() string {
+	name := fmt.Sprintf("dockerspy_%s_%s", runtime.GOOS, runtime.GOARCH)
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+func latestRelease() (*release, error) {
+	resp, err := httpClient.Get(latestReleaseURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if err := classifyResponse(resp, "check for updates"); err != nil {
+		return nil, err
+	}
+
+	var latest release
+	if err := json.NewDecoder(resp.Body).Decode(&latest); err != nil {
+		return nil, err
+	}
+	return &latest, nil
+}
+
+// newerVersion compares dotted numeric versions; a non-numeric part counts
+// as 0.
+func newerVersion(candidate, current string) bool {
+	a := strings.Split(candidate, ".")
+	b := strings.Split(current, ".")
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var x, y int
+		if i < len(a) {
+			x, _ = strconv.Atoi(a[i])
+		}
+		if i < len(b) {
+			y, _ = strconv.Atoi(b[i])
+		}
+		if x != y {
+			return x > y
+		}
+	}
+	return false
+}
+
+func releaseKey() (ed25519.PublicKey, error) {
+	if releasePublicKey == "" {
+		return nil, fmt.Errorf("this build has no release signing key, updates cannot be verified")
+	}
+	key, err := hex.DecodeString(releasePublicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid release signing key")
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+func downloadAsset(assetURL string) ([]byte, error) {
+	resp, err := httpClient.Get(assetURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if err := classifyResponse(resp, "download release asset"); err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxReleaseAsset+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxReleaseAsset {
+		return nil, fmt.Errorf("release asset exceeds %d bytes", maxReleaseAsset)
+	}
+	return data, nil
+}
+
+// downloadVerified fetches the asset name and its detached, base64-encoded
+// ed25519 signature name.sig, and returns the asset only if they match.
+func downloadVerified(r *release, name string, key ed25519.PublicKey) ([]byte, error) {
+	assetURL, ok := r.asset(name)
+	if !ok {
+		return nil, fmt.Errorf("release %s has no asset %s", r.TagName, name)
+	}
+	sigURL, ok := r.asset(name + ".sig")
+	if !ok {
+		return nil, fmt.Errorf("release %s has no signature for %s", r.TagName, name)
+	}
+
+	data, err := downloadAsset(assetURL)
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := downloadAsset(sigURL)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+	if err != nil {
+		return nil, fmt.Errorf("malformed signature for %s: %v", name, err)
+	}
+	if !ed25519.Verify(key, data, sig) {
+		return nil, fmt.Errorf("signature verification failed for %s", name)
+	}
+	return data, nil
+}
+
+// replaceFile writes data next to path and renames it into place, so a
+// failed update never leaves a truncated file behind.
+func replaceFile(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func updateBinary(r *release, key ed25519.PublicKey) error {
+	data, err := downloadVerified(r, binaryAssetName(), key)
+	if err != nil {
+		return err
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = resolved
+	}
+	return replaceFile(exe, data, 0o755)
+}
+
+// updatedRulesDir holds rule sets installed by the update command. They take
+// the place of the rules built into the binary.
+func updatedRulesDir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "dockerspy", "rules")
+}
+
+// updateRules installs the rule sets published with r and returns the names
+// of the files that were replaced.
+func updateRules(r *release, key ed25519.PublicKey) ([]string, error) {
+	dir := updatedRulesDir()
+	if dir == "" {
+		return nil, fmt.Errorf("no user config directory to install rules into")
+	}
+
+	downloaded := make(map[string][]byte)
+	for _, name := range ruleFiles {
+		if _, ok := r.asset(name); !ok {
+			continue
+		}
+		data, err := downloadVerified(r, name, key)
+		if err != nil {
+			return nil, err
+		}
+		if err := validateRules(name, data); err != nil {
+			return nil, fmt.Errorf("%s from %s is not usable: %v", name, r.TagName, err)
+		}
+		downloaded[name] = data
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	var updated []string
+	for _, name := range ruleFiles {
+		data, ok := downloaded[name]
+		if !ok {
+			continue
+		}
+		if err := replaceFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			return updated, err
+		}
+		updated = append(updated, name)
+	}
+	if len(updated) > 0 {
+		if err := replaceFile(filepath.Join(dir, rulesVersionFile), []byte(r.version()+"\n"), 0o644); err != nil {
+			return updated, err
+		}
+	}
+	return updated, nil
+}
+
+func validateRules(name string, data []byte) error {
+	switch name {
+	case "regex_patterns.json":
+		var patterns map[string]string
+		if err := json.Unmarshal(data, &patterns); err != nil {
+			return err
+		}
+		for rule, pattern := range patterns {
+			if _, err := compileMatcher(rule, pattern); err != nil {
+				return fmt.Errorf("rule %s: %v", rule, err)
+			}
+		}
+	case "ignore_extensions.json":
+		var ignore IgnoreExtensions
+		return json.Unmarshal(data, &ignore)
+	case "placeholders.json":
+		var placeholders PlaceholderList
+		return json.Unmarshal(data, &placeholders)
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// vexSelector picks the leaked credential a VEX document is about: every
+// finding of Rule (any rule when empty) whose value contains Match.
+type vexSelector struct {
+	ID     string
+	Rule   string
+	Match  string
+	Author string
+}
+
+func (s vexSelector) affects(report *Report) bool {
+	for _, rules := range report.Matches {
+		for rule, matches := range rules {
+			if s.Rule != "" && rule != s.Rule {
+				continue
+			}
+			for _, match := range matches {
+				if strings.Contains(match, s.Match) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func (s vexSelector) vulnerabilityID() string {
+	if s.ID != "" {
+		return s.ID
+	}
+	sum := sha256.Sum256([]byte(s.Rule + "\x00" + s.Match))
+	return "DOCKERSPY-" + strings.ToUpper(hex.EncodeToString(sum[:6]))
+}
+
+func (s vexSelector) description() string {
+	if s.Rule != "" && s.Match != "" {
+		return fmt.Sprintf("Leaked credential matching rule %s", s.Rule)
+	}
+	if s.Rule != "" {
+		return fmt.Sprintf("Credentials leaked under rule %s", s.Rule)
+	}
+	return "Leaked credential"
+}
+
+func (s vexSelector) actionStatement() string {
+	if s.Rule != "" {
+		if remediation, ok := ruleRemediations[s.Rule]; ok {
+			return strings.Join(remediation.Steps, "; ")
+		}
+	}
+	return "Revoke the leaked credential and publish a rebuilt image that no longer contains it."
+}
+
+func imagePURL(report *Report) string {
+	ref := parseImageReference(report.SelectedRepo)
+	version := report.SelectedTag
+	if report.Digest != "" {
+		version = strings.Replace(report.Digest, ":", "%3A", 1)
+	}
+	purl := fmt.Sprintf("pkg:docker/%s@%s", ref.path(), version)
+	if !ref.isDockerHub() {
+		purl += "?repository_url=" + url.QueryEscape(ref.Registry)
+	}
+	return purl
+}
+
+func buildVEX(reports []*Report, selector vexSelector, format string) ([]byte, error) {
+	var affected, unaffected []*Report
+	for _, report := range reports {
+		if selector.affects(report) {
+			affected = append(affected, report)
+		} else {
+			unaffected = append(unaffected, report)
+		}
+	}
+
+	switch format {
+	case "", "openvex":
+		return json.MarshalIndent(openVEXDocument(affected, unaffected, selector), "", "  ")
+	case "csaf":
+		return json.MarshalIndent(csafVEXDocument(affected, unaffected, selector), "", "  ")
+	default:
+		return nil, fmt.Errorf("unknown VEX format: %s", format)
+	}
+}
+
+func openVEXDocument(affected, unaffected []*Report, selector vexSelector) map[string]interface{} {
+	now := time.Now().UTC().Format(time.RFC3339)
+	vulnerability := map[string]string{"name": selector.vulnerabilityID(), "description": selector.description()}
+
+	products := func(reports []*Report) []map[string]string {
+		var list []map[string]string
+		for _, report := range reports {
+			list = append(list, map[string]string{"@id": imagePURL(report)})
+		}
+		return list
+	}
+
+	var statements []map[string]interface{}
+	if len(affected) > 0 {
+		statements = append(statements, map[string]interface{}{
+			"vulnerability":    vulnerability,
+			"products":         products(affected),
+			"status":           "affected",
+			"action_statement": selector.actionStatement(),
+		})
+	}
+	if len(unaffected) > 0 {
+		statements = append(statements, map[string]interface{}{
+			"vulnerability": vulnerability,
+			"products":      products(unaffected),
+			"status":        "not_affected",
+			"justification": "vulnerable_code_not_present",
+		})
+	}
+
+	sum := sha256.Sum256([]byte(selector.vulnerabilityID() + now))
+	return map[string]interface{}{
+		"@context":   "https://openvex.dev/ns/v0.2.0",
+		"@id":        "https://openvex.dev/docs/public/vex-" + hex.EncodeToString(sum[:]),
+		"author":     selector.Author,
+		"timestamp":  now,
+		"version":    1,
+		"statements": statements,
+	}
+}
+
+func csafVEXDocument(affected, unaffected []*Report, selector vexSelector) map[string]interface{} {
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	var products []map[string]interface{}
+	productIDs := func(reports []*Report) []string {
+		var ids []string
+		for _, report := range reports {
+			id := fmt.Sprintf("CSAFPID-%04d", len(products)+1)
+			products = append(products, map[string]interface{}{
+				"product_id": id,
+				"name":       reportImage(report),
+				"product_identification_helper": map[string]string{
+					"purl": imagePURL(report),
+				},
+			})
+			ids = append(ids, id)
+		}
+		return ids
+	}
+	affectedIDs := productIDs(affected)
+	unaffectedIDs := productIDs(unaffected)
+
+	status := map[string][]string{}
+	vulnerability := map[string]interface{}{
+		"ids":   []map[string]string{{"system_name": "DockerSpy", "text": selector.vulnerabilityID()}},
+		"notes": []map[string]string{{"category": "description", "text": selector.description()}},
+	}
+	if len(affectedIDs) > 0 {
+		status["known_affected"] = affectedIDs
+		vulnerability["remediations"] = []map[string]interface{}{{
+			"category":    "mitigation",
+			"details":     selector.actionStatement(),
+			"product_ids": affectedIDs,
+		}}
+	}
+	if len(unaffectedIDs) > 0 {
+		status["known_not_affected"] = unaffectedIDs
+		vulnerability["flags"] = []map[string]interface{}{{
+			"label":       "vulnerable_code_not_present",
+			"product_ids": unaffectedIDs,
+		}}
+	}
+	vulnerability["product_status"] = status
+
+	return map[string]interface{}{
+		"document": map[string]interface{}{
+			"category":     "csaf_vex",
+			"csaf_version": "2.0",
+			"title":        selector.description(),
+			"publisher": map[string]string{
+				"category":  "user",
+				"name":      selector.Author,
+				"namespace": "https://github.com/UndeadSec/DockerSpy",
+			},
+			"tracking": map[string]interface{}{
+				"id":                   selector.vulnerabilityID(),
+				"status":               "final",
+				"version":              "1",
+				"initial_release_date": now,
+				"current_release_date": now,
+				"revision_history": []map[string]string{
+					{"number": "1", "date": now, "summary": "Initial version"},
+				},
+			},
+		},
+		"product_tree": map[string]interface{}{
+			"full_product_names": products,
+		},
+		"vulnerabilities": []map[string]interface{}{vulnerability},
+	}
+}
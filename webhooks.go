@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+type webhookPipeline struct {
+	Name                string       `json:"name"`
+	ExpectFinalCallback bool         `json:"expect_final_callback"`
+	Webhooks            []hubWebhook `json:"webhooks"`
+}
+
+type hubWebhook struct {
+	Name    string `json:"name"`
+	HookURL string `json:"hook_url"`
+}
+
+func webhookPipelinesURL(repo string) string {
+	return fmt.Sprintf("https://hub.docker.com/v2/repositories/%s/webhook_pipeline/", hubRepoPath(repo))
+}
+
+func listWebhooks(repo, jwt string) ([]webhookPipeline, error) {
+	var pipelines []webhookPipeline
+	err := fetchHubPages(webhookPipelinesURL(repo), jwt, "list webhooks", func(item json.RawMessage) error {
+		var pipeline webhookPipeline
+		if err := json.Unmarshal(item, &pipeline); err != nil {
+			return err
+		}
+		pipelines = append(pipelines, pipeline)
+		return nil
+	})
+	return pipelines, err
+}
+
+// ensureWebhook registers a push webhook named name that calls hookURL. It
+// reports false without changing anything when a webhook with that name is
+// already configured on the repository.
+func ensureWebhook(repo, jwt, name, hookURL string) (bool, error) {
+	pipelines, err := listWebhooks(repo, jwt)
+	if err != nil {
+		return false, err
+	}
+	for _, pipeline := range pipelines {
+		if pipeline.Name == name {
+			return false, nil
+		}
+	}
+
+	body, err := json.Marshal(webhookPipeline{
+		Name:     name,
+		Webhooks: []hubWebhook{{Name: name, HookURL: hookURL}},
+	})
+	if err != nil {
+		return false, err
+	}
+
+	req, err := http.NewRequest("POST", webhookPipelinesURL(repo), bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+jwt)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if err := classifyResponse(resp, "create webhook"); err != nil {
+		return false, err
+	}
+	return true, nil
+}